@@ -8,6 +8,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ecs"
+	"github.com/aws/aws-sdk-go/service/s3"
 )
 
 type ecsClient struct {
@@ -16,15 +17,8 @@ type ecsClient struct {
 }
 
 func newClient(vault Vault, logHttp bool) *ecsClient {
-	region := vault.AwsRegion()
 	envName := vault.EnvName()
-	sess, err := session.NewSession(&aws.Config{
-		Region:      &region,
-		Credentials: credentials.NewStaticCredentials(vault.AwsKey(), vault.AwsSecret(), ""),
-	})
-	if err != nil {
-		panic(err)
-	}
+	sess := newSession(vault, vault.AwsRegion())
 	config := &aws.Config{}
 	if logHttp {
 		config.LogLevel = aws.LogLevel(aws.LogDebugWithHTTPBody)
@@ -35,6 +29,25 @@ func newClient(vault Vault, logHttp bool) *ecsClient {
 	}
 }
 
+func newSession(vault Vault, region string) *session.Session {
+	sess, err := session.NewSession(&aws.Config{
+		Region:      &region,
+		Credentials: credentials.NewStaticCredentials(vault.AwsKey(), vault.AwsSecret(), ""),
+	})
+	if err != nil {
+		panic(err)
+	}
+	return sess
+}
+
+func deleteS3Object(vault Vault, region string, bucket string, key string) error {
+	_, err := s3.New(newSession(vault, region)).DeleteObject(&s3.DeleteObjectInput{
+		Bucket: &bucket,
+		Key:    &key,
+	})
+	return err
+}
+
 func (client *ecsClient) listInstances() ([]string, error) {
 	out, err := client.c.ListContainerInstances(&ecs.ListContainerInstancesInput{
 		Cluster: client.cluster,
@@ -0,0 +1,297 @@
+package libtf
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+type hclConfBackend struct {
+	Bucket             string `hcl:"bucket"`
+	Region             string `hcl:"region"`
+	LockTable          string `hcl:"lock_table"`
+	Prefix             string `hcl:"prefix"`
+	Credentials        string `hcl:"credentials"`
+	Path               string `hcl:"path"`
+	StorageAccountName string `hcl:"storage_account_name"`
+	ResourceGroupName  string `hcl:"resource_group_name"`
+	ContainerName      string `hcl:"container_name"`
+	Address            string `hcl:"address"`
+	LockAddress        string `hcl:"lock_address"`
+	UnlockAddress      string `hcl:"unlock_address"`
+}
+
+type StateBackend interface {
+	Type() string
+	Config(vault Vault, target string) (map[string]interface{}, error)
+	StateRef(vault Vault, target string) string
+	DeleteState(vault Vault, target string) error
+}
+
+type backendBase struct {
+	conf       hclConfBackend
+	workspaces bool
+}
+
+func (backend backendBase) stateKey(vault Vault, target string) string {
+	if backend.workspaces {
+		return WorkspaceStateKey(target)
+	}
+	return StateKey(vault.EnvName(), target)
+}
+
+func (backend backendBase) expand(template string, vault Vault, target string) string {
+	return strings.NewReplacer(
+		"{env}", vault.EnvName(),
+		"{target}", target,
+		"{key}", backend.stateKey(vault, target),
+	).Replace(template)
+}
+
+type s3Backend struct {
+	backendBase
+}
+
+func (backend s3Backend) Type() string {
+	return "s3"
+}
+
+func (backend s3Backend) bucket(vault Vault) string {
+	if len(backend.conf.Bucket) != 0 {
+		return backend.conf.Bucket
+	}
+	return vault.stateBucket()
+}
+
+func (backend s3Backend) region(vault Vault) string {
+	if len(backend.conf.Region) != 0 {
+		return backend.conf.Region
+	}
+	return vault.AwsRegion()
+}
+
+func (backend s3Backend) Config(vault Vault, target string) (map[string]interface{}, error) {
+	config := map[string]interface{}{
+		"bucket":  backend.bucket(vault),
+		"key":     backend.stateKey(vault, target),
+		"region":  backend.region(vault),
+		"encrypt": true,
+	}
+	lockTable := backend.conf.LockTable
+	if len(lockTable) == 0 {
+		lockTable = vault.stateLockTable()
+	}
+	if len(lockTable) != 0 {
+		config["dynamodb_table"] = lockTable
+	}
+	return config, nil
+}
+
+func (backend s3Backend) StateRef(vault Vault, target string) string {
+	if backend.workspaces {
+		return fmt.Sprintf("env:/%s/%s", vault.EnvName(), backend.stateKey(vault, target))
+	}
+	return backend.stateKey(vault, target)
+}
+
+func (backend s3Backend) DeleteState(vault Vault, target string) error {
+	return deleteS3Object(vault, backend.region(vault), backend.bucket(vault), backend.StateRef(vault, target))
+}
+
+type localBackend struct {
+	backendBase
+}
+
+func (backend localBackend) Type() string {
+	return "local"
+}
+
+func (backend localBackend) statePath(vault Vault, target string) string {
+	template := backend.conf.Path
+	if len(template) == 0 {
+		template = ".tfstate/{key}"
+	}
+	statePath, err := filepath.Abs(backend.expand(template, vault, target))
+	if err != nil {
+		panic(err)
+	}
+	return statePath
+}
+
+func (backend localBackend) Config(vault Vault, target string) (map[string]interface{}, error) {
+	statePath := backend.statePath(vault, target)
+	if err := os.MkdirAll(filepath.Dir(statePath), 0700); err != nil {
+		return nil, err
+	}
+	config := map[string]interface{}{
+		"path": statePath,
+	}
+	if backend.workspaces {
+		config["workspace_dir"] = statePath + ".d"
+	}
+	return config, nil
+}
+
+func (backend localBackend) StateRef(vault Vault, target string) string {
+	if backend.workspaces {
+		return filepath.Join(backend.statePath(vault, target)+".d", vault.EnvName(), "terraform.tfstate")
+	}
+	return backend.statePath(vault, target)
+}
+
+func (backend localBackend) DeleteState(vault Vault, target string) error {
+	if err := os.Remove(backend.StateRef(vault, target)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+type gcsBackend struct {
+	backendBase
+}
+
+func (backend gcsBackend) Type() string {
+	return "gcs"
+}
+
+func (backend gcsBackend) Config(vault Vault, target string) (map[string]interface{}, error) {
+	config := map[string]interface{}{
+		"bucket": backend.conf.Bucket,
+		"prefix": path.Join(backend.conf.Prefix, backend.stateKey(vault, target)),
+	}
+	if len(backend.conf.Credentials) != 0 {
+		config["credentials"] = backend.conf.Credentials
+	}
+	return config, nil
+}
+
+func (backend gcsBackend) StateRef(vault Vault, target string) string {
+	workspace := "default"
+	if backend.workspaces {
+		workspace = vault.EnvName()
+	}
+	return path.Join(backend.conf.Prefix, backend.stateKey(vault, target), workspace+".tfstate")
+}
+
+func (backend gcsBackend) DeleteState(vault Vault, target string) error {
+	color.Yellow("backend gcs cannot delete state, remove %s manually", backend.StateRef(vault, target))
+	return nil
+}
+
+type azurermBackend struct {
+	backendBase
+}
+
+func (backend azurermBackend) Type() string {
+	return "azurerm"
+}
+
+func (backend azurermBackend) Config(vault Vault, target string) (map[string]interface{}, error) {
+	config := map[string]interface{}{
+		"storage_account_name": backend.conf.StorageAccountName,
+		"container_name":       backend.conf.ContainerName,
+		"key":                  backend.stateKey(vault, target),
+	}
+	if len(backend.conf.ResourceGroupName) != 0 {
+		config["resource_group_name"] = backend.conf.ResourceGroupName
+	}
+	return config, nil
+}
+
+func (backend azurermBackend) StateRef(vault Vault, target string) string {
+	if backend.workspaces {
+		return fmt.Sprintf("%senv:%s", backend.stateKey(vault, target), vault.EnvName())
+	}
+	return backend.stateKey(vault, target)
+}
+
+func (backend azurermBackend) DeleteState(vault Vault, target string) error {
+	color.Yellow("backend azurerm cannot delete state, remove %s manually", backend.StateRef(vault, target))
+	return nil
+}
+
+type httpBackend struct {
+	backendBase
+}
+
+func (backend httpBackend) Type() string {
+	return "http"
+}
+
+func (backend httpBackend) Config(vault Vault, target string) (map[string]interface{}, error) {
+	config := map[string]interface{}{
+		"address": backend.StateRef(vault, target),
+	}
+	if len(backend.conf.LockAddress) != 0 {
+		config["lock_address"] = backend.expand(backend.conf.LockAddress, vault, target)
+	}
+	if len(backend.conf.UnlockAddress) != 0 {
+		config["unlock_address"] = backend.expand(backend.conf.UnlockAddress, vault, target)
+	}
+	return config, nil
+}
+
+func (backend httpBackend) StateRef(vault Vault, target string) string {
+	return backend.expand(backend.conf.Address, vault, target)
+}
+
+func (backend httpBackend) DeleteState(vault Vault, target string) error {
+	color.Yellow("backend http cannot delete state, remove %s manually", backend.StateRef(vault, target))
+	return nil
+}
+
+func newStateBackend(backendType string, conf hclConfBackend, workspaces bool) (StateBackend, error) {
+	base := backendBase{conf: conf, workspaces: workspaces}
+	switch backendType {
+	case "s3":
+		return s3Backend{base}, nil
+	case "local":
+		return localBackend{base}, nil
+	case "gcs":
+		if len(conf.Bucket) == 0 {
+			return nil, errors.New("backend.gcs.bucket is not defined")
+		}
+		return gcsBackend{base}, nil
+	case "azurerm":
+		if len(conf.StorageAccountName) == 0 {
+			return nil, errors.New("backend.azurerm.storage_account_name is not defined")
+		}
+		if len(conf.ContainerName) == 0 {
+			return nil, errors.New("backend.azurerm.container_name is not defined")
+		}
+		return azurermBackend{base}, nil
+	case "http":
+		if len(conf.Address) == 0 {
+			return nil, errors.New("backend.http.address is not defined")
+		}
+		if workspaces {
+			return nil, errors.New("backend http does not support workspaces")
+		}
+		return httpBackend{base}, nil
+	default:
+		return nil, fmt.Errorf("backend %s is not supported", backendType)
+	}
+}
+
+func (conf *HclConf) StateBackend() (StateBackend, error) {
+	if len(conf.Backend) > 1 {
+		return nil, errors.New("only one backend can be defined")
+	}
+	for backendType, backendConf := range conf.Backend {
+		return newStateBackend(backendType, backendConf, conf.Global.Workspaces)
+	}
+	return newStateBackend("s3", hclConfBackend{}, conf.Global.Workspaces)
+}
+
+func (conf *HclConf) usesVaultStateBucket() bool {
+	if len(conf.Backend) == 0 {
+		return true
+	}
+	backend, found := conf.Backend["s3"]
+	return found && len(backend.Bucket) == 0
+}
@@ -0,0 +1,89 @@
+package libtf
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStateBackends(t *testing.T) {
+	vault := Vault{Env: map[string]interface{}{
+		"env_name":        "staging",
+		"aws_region":      "eu-west-1",
+		"tf_state_bucket": "states",
+	}}
+
+	s3, err1 := (&HclConf{}).StateBackend()
+	assert.Nil(t, err1)
+	config1, _ := s3.Config(vault, "app")
+	assert.Equal(t, map[string]interface{}{
+		"bucket":  "states",
+		"key":     "staging-app.tfstate",
+		"region":  "eu-west-1",
+		"encrypt": true,
+	}, config1)
+
+	local, err2 := newStateBackend("local", hclConfBackend{Path: "/tmp/tf-test/{env}/{target}.tfstate"}, false)
+	assert.Nil(t, err2)
+	assert.Equal(t, filepath.FromSlash("/tmp/tf-test/staging/app.tfstate"), local.StateRef(vault, "app"))
+
+	gcs, err3 := newStateBackend("gcs", hclConfBackend{Bucket: "states", Prefix: "tf"}, false)
+	assert.Nil(t, err3)
+	config3, _ := gcs.Config(vault, "app")
+	assert.Equal(t, "tf/staging-app.tfstate", config3["prefix"])
+
+	http, err4 := newStateBackend("http", hclConfBackend{Address: "https://state/{key}"}, false)
+	assert.Nil(t, err4)
+	assert.Equal(t, "https://state/staging-app.tfstate", http.StateRef(vault, "app"))
+
+	_, err5 := newStateBackend("azurerm", hclConfBackend{}, false)
+	assert.Error(t, err5)
+
+	_, err6 := newStateBackend("consul", hclConfBackend{}, false)
+	assert.Error(t, err6)
+}
+
+func TestWorkspaceStateBackends(t *testing.T) {
+	vault := Vault{Env: map[string]interface{}{
+		"env_name":        "staging",
+		"aws_region":      "eu-west-1",
+		"tf_state_bucket": "states",
+	}}
+
+	s3, _ := newStateBackend("s3", hclConfBackend{}, true)
+	config1, _ := s3.Config(vault, "app")
+	assert.Equal(t, "app.tfstate", config1["key"])
+	assert.Equal(t, "env:/staging/app.tfstate", s3.StateRef(vault, "app"))
+
+	local, _ := newStateBackend("local", hclConfBackend{Path: "/tmp/tf-test/{key}"}, true)
+	assert.Equal(t, filepath.FromSlash("/tmp/tf-test/app.tfstate.d/staging/terraform.tfstate"), local.StateRef(vault, "app"))
+
+	gcs, _ := newStateBackend("gcs", hclConfBackend{Bucket: "states", Prefix: "tf"}, true)
+	assert.Equal(t, "tf/app.tfstate/staging.tfstate", gcs.StateRef(vault, "app"))
+
+	_, err := newStateBackend("http", hclConfBackend{Address: "https://state/{key}"}, true)
+	assert.Error(t, err)
+}
+
+func TestDeleteStateWithoutS3(t *testing.T) {
+	dir := writeConfFiles(t, map[string]string{".tfstate/staging-app.tfstate": "{}"})
+
+	vault := Vault{Env: map[string]interface{}{"env_name": "staging"}}
+	statePath := filepath.Join(dir, ".tfstate", "staging-app.tfstate")
+
+	local := HclConf{Backend: map[string]hclConfBackend{"local": {Path: statePath}}}
+	assert.Nil(t, local.DeleteState(vault, "app"))
+	_, err := os.Stat(statePath)
+	assert.True(t, os.IsNotExist(err))
+	assert.Nil(t, local.DeleteState(vault, "app"))
+
+	for _, conf := range []HclConf{
+		{Backend: map[string]hclConfBackend{"gcs": {Bucket: "states"}}},
+		{Backend: map[string]hclConfBackend{"azurerm": {StorageAccountName: "states", ContainerName: "tf"}}},
+		{Backend: map[string]hclConfBackend{"http": {Address: "https://state/{key}"}}},
+	} {
+		assert.Nil(t, conf.DeleteState(vault, "app"))
+	}
+}
@@ -7,15 +7,49 @@ import (
 type ComposeConfig struct {
 	Version  string                          `yaml:"version"`
 	Services map[string]composeServiceConfig `yaml:"services"`
+	Volumes  map[string]composeVolume        `yaml:"volumes,omitempty"`
 }
 
 type composeServiceConfig struct {
-	Image       string            `yaml:"image"`
-	Links       []string          `yaml:"links,omitempty"`
-	Command     string            `yaml:"command,omitempty"`
-	Environment map[string]string `yaml:"environment,omitempty"`
-	Ports       []int             `yaml:"ports,omitempty"`
-	Logging     map[string]string `yaml:"logging,omitempty"`
+	Image       string              `yaml:"image"`
+	Links       []string            `yaml:"links,omitempty"`
+	Command     []string            `yaml:"command,omitempty"`
+	Environment map[string]string   `yaml:"environment,omitempty"`
+	Ports       []interface{}       `yaml:"ports,omitempty"`
+	Logging     *composeLogging     `yaml:"logging,omitempty"`
+	Healthcheck *composeHealthcheck `yaml:"healthcheck,omitempty"`
+
+	Cpus            float64                      `yaml:"cpus,omitempty"`
+	MemLimit        string                       `yaml:"mem_limit,omitempty"`
+	Ulimits         map[string]composeUlimit     `yaml:"ulimits,omitempty"`
+	StopGracePeriod string                       `yaml:"stop_grace_period,omitempty"`
+	User            string                       `yaml:"user,omitempty"`
+	WorkingDir      string                       `yaml:"working_dir,omitempty"`
+	Entrypoint      []string                     `yaml:"entrypoint,omitempty"`
+	ReadOnly        bool                         `yaml:"read_only,omitempty"`
+	Init            bool                         `yaml:"init,omitempty"`
+	CapAdd          []string                     `yaml:"cap_add,omitempty"`
+	CapDrop         []string                     `yaml:"cap_drop,omitempty"`
+	Volumes         []string                     `yaml:"volumes,omitempty"`
+	VolumesFrom     []string                     `yaml:"volumes_from,omitempty"`
+	NetworkMode     string                       `yaml:"network_mode,omitempty"`
+	DNS             []string                     `yaml:"dns,omitempty"`
+	DNSSearch       []string                     `yaml:"dns_search,omitempty"`
+	ExtraHosts      []string                     `yaml:"extra_hosts,omitempty"`
+	Hostname        string                       `yaml:"hostname,omitempty"`
+	DependsOn       map[string]composeDependency `yaml:"depends_on,omitempty"`
+}
+
+type composeUlimit struct {
+	Soft int `yaml:"soft"`
+	Hard int `yaml:"hard"`
+}
+
+func composeMemory(megabytes int) string {
+	if megabytes == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%dm", megabytes)
 }
 
 func mergeEnv(a map[string]string, b map[string]string) map[string]string {
@@ -31,39 +65,72 @@ func mergeEnv(a map[string]string, b map[string]string) map[string]string {
 
 func (conf *HclConf) AsCompose(vault Vault) ComposeConfig {
 	config := ComposeConfig{
-		Version:  "2",
+		Version:  "2.4",
 		Services: make(map[string]composeServiceConfig),
 	}
 	for _, service := range conf.Services {
 		if !service.Compose {
 			continue
 		}
-		config.Services[service.Name] = service.asCompose(conf.Global.BaseImage, vault)
+		config.Services[service.Name] = service.asCompose(conf, vault)
 	}
+	config.Volumes = conf.composeNamedVolumes()
 	return config
 }
 
-func (service *hclConfService) asCompose(baseImage string, vault Vault) composeServiceConfig {
-	serviceEnv := service.Env
+func (service *hclConfService) asCompose(conf *HclConf, vault Vault) composeServiceConfig {
+	network := conf.serviceNetwork(service)
+	serviceEnv := mergeEnv(service.Env, conf.discoveryEnv(service, network, true))
 	if !service.NoEnv {
 		serviceEnv = mergeEnv(vault.Raw, serviceEnv)
 	}
-	var logging map[string]string
-	if service.NoLog {
-		logging = map[string]string{
-			"driver": "none",
-		}
-	}
 	image := service.Image
 	if len(image) == 0 {
-		image = fmt.Sprintf("%s:%s", baseImage, GetGitVersion())
+		image = fmt.Sprintf("%s:%s", conf.Global.BaseImage, GetGitVersion())
+	}
+	command, _ := service.commandArgs()
+	var ports []interface{}
+	servicePorts, _ := service.servicePorts()
+	for _, port := range servicePorts {
+		ports = append(ports, port.asCompose())
+	}
+	var ulimits map[string]composeUlimit
+	for name, ulimit := range service.Ulimits {
+		if ulimits == nil {
+			ulimits = map[string]composeUlimit{}
+		}
+		ulimits[name] = composeUlimit{
+			Soft: ulimit.Soft,
+			Hard: ulimit.Hard,
+		}
 	}
 	return composeServiceConfig{
 		Image:       image,
 		Links:       service.Links,
-		Ports:       service.Ports,
+		Ports:       ports,
 		Environment: serviceEnv,
-		Command:     service.Command,
-		Logging:     logging,
+		Command:     command,
+		Logging:     service.composeLogging(conf, vault.EnvName()),
+		Healthcheck: service.Healthcheck.asCompose(),
+
+		Cpus:            float64(service.Cpu) / 1024,
+		MemLimit:        composeMemory(service.MemoryLimit),
+		Ulimits:         ulimits,
+		StopGracePeriod: service.StopTimeout,
+		User:            service.User,
+		WorkingDir:      service.WorkingDir,
+		Entrypoint:      service.Entrypoint,
+		ReadOnly:        service.ReadonlyRoot,
+		Init:            service.Init,
+		CapAdd:          service.CapAdd,
+		CapDrop:         service.CapDrop,
+		Volumes:         service.composeVolumes(conf),
+		VolumesFrom:     service.VolumesFrom,
+		NetworkMode:     network.composeMode(),
+		DNS:             network.Dns,
+		DNSSearch:       network.SearchDomains,
+		ExtraHosts:      network.composeExtraHosts(),
+		Hostname:        network.Hostname,
+		DependsOn:       service.composeDependsOn(conf),
 	}
 }
@@ -0,0 +1,176 @@
+package libtf
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+)
+
+type hclConfDependency struct {
+	Service   string `hcl:"service"`
+	Condition string `hcl:"condition"`
+}
+
+type ecsDependency struct {
+	ContainerName string `json:"containerName"`
+	Condition     string `json:"condition"`
+}
+
+type composeDependency struct {
+	Condition string `yaml:"condition"`
+}
+
+var ecsConditions = map[string]bool{
+	"START":    true,
+	"COMPLETE": true,
+	"SUCCESS":  true,
+	"HEALTHY":  true,
+}
+
+var composeConditions = map[string]string{
+	"START":   "service_started",
+	"HEALTHY": "service_healthy",
+}
+
+func objectTypes(node ast.Node) []*ast.ObjectType {
+	switch node.(type) {
+	case *ast.ObjectType:
+		return []*ast.ObjectType{node.(*ast.ObjectType)}
+	case *ast.ListType:
+		res := []*ast.ObjectType{}
+		for _, item := range node.(*ast.ListType).List {
+			res = append(res, objectTypes(item)...)
+		}
+		return res
+	default:
+		return nil
+	}
+}
+
+func labeledBodies(list *ast.ObjectList, res map[string][]*ast.ObjectType) {
+	for _, item := range list.Items {
+		if len(item.Keys) == 0 {
+			for _, object := range objectTypes(item.Val) {
+				labeledBodies(object.List, res)
+			}
+			continue
+		}
+		label := item.Keys[0].Token.Value().(string)
+		if len(item.Keys) > 1 {
+			nested := *item
+			nested.Keys = item.Keys[1:]
+			labeledBodies(&ast.ObjectList{Items: []*ast.ObjectItem{&nested}}, res)
+			continue
+		}
+		res[label] = append(res[label], objectTypes(item.Val)...)
+	}
+}
+
+func (conf *HclConf) decodeDependencies(root *ast.File) error {
+	list, ok := root.Node.(*ast.ObjectList)
+	if !ok {
+		return nil
+	}
+	bodies := map[string][]*ast.ObjectType{}
+	labeledBodies(list.Filter("service"), bodies)
+	for name, objects := range bodies {
+		dependencies := []hclConfDependency{}
+		for _, object := range objects {
+			for _, item := range object.List.Filter("depends_on").Items {
+				for _, block := range objectTypes(item.Val) {
+					dependency := hclConfDependency{}
+					if err := hcl.DecodeObject(&dependency, block); err != nil {
+						return fmt.Errorf("service.%s.depends_on: %s", name, err)
+					}
+					dependencies = append(dependencies, dependency)
+				}
+			}
+		}
+		if service, found := conf.Services[name]; found && len(dependencies) != 0 {
+			service.DependsOn = dependencies
+			conf.Services[name] = service
+		}
+	}
+	return nil
+}
+
+func decodeHclConfPart(data []byte, part *HclConf) error {
+	root, err := hcl.ParseBytes(data)
+	if err != nil {
+		return err
+	}
+	return decodeHclConfRoot(root, part)
+}
+
+func decodeHclConfRoot(root *ast.File, part *HclConf) error {
+	if err := hcl.DecodeObject(part, root); err != nil {
+		return err
+	}
+	return part.decodeDependencies(root)
+}
+
+func (dependency hclConfDependency) condition() string {
+	if len(dependency.Condition) == 0 {
+		return "START"
+	}
+	return strings.ToUpper(dependency.Condition)
+}
+
+func (conf *HclConf) validateDependencies() error {
+	edges := map[string][]string{}
+	for _, name := range conf.serviceNames() {
+		service := conf.Services[name]
+		for _, dependency := range service.DependsOn {
+			other, found := conf.Services[dependency.Service]
+			if !found {
+				return fmt.Errorf("services.%s depends on unknown service %s", name, dependency.Service)
+			}
+			if !ecsConditions[dependency.condition()] {
+				return fmt.Errorf("services.%s.depends_on condition %s is not one of START, COMPLETE, SUCCESS, HEALTHY", name, dependency.Condition)
+			}
+			if _, found := composeConditions[dependency.condition()]; !found && service.Compose && other.Compose {
+				return fmt.Errorf("services.%s.depends_on condition %s is not supported by compose, use START or HEALTHY", name, dependency.Condition)
+			}
+			if dependency.condition() == "HEALTHY" && other.Healthcheck == nil {
+				return fmt.Errorf("services.%s waits for %s to be healthy but it has no healthcheck", name, dependency.Service)
+			}
+			if len(service.Ecs) != 0 && other.Ecs != service.Ecs {
+				return fmt.Errorf("services.%s depends on %s which is not in ecs %s", name, dependency.Service, service.Ecs)
+			}
+			edges[name] = append(edges[name], dependency.Service)
+		}
+	}
+	if _, err := topoSort(conf.serviceNames(), edges); err != nil {
+		return fmt.Errorf("services: %s", err)
+	}
+	return nil
+}
+
+func (service *hclConfService) ecsDependsOn() []ecsDependency {
+	res := []ecsDependency{}
+	for _, dependency := range service.DependsOn {
+		res = append(res, ecsDependency{
+			ContainerName: dependency.Service,
+			Condition:     dependency.condition(),
+		})
+	}
+	return res
+}
+
+func (service *hclConfService) composeDependsOn(conf *HclConf) map[string]composeDependency {
+	var res map[string]composeDependency
+	for _, dependency := range service.DependsOn {
+		if !conf.Services[dependency.Service].Compose {
+			continue
+		}
+		if res == nil {
+			res = map[string]composeDependency{}
+		}
+		res[dependency.Service] = composeDependency{
+			Condition: composeConditions[dependency.condition()],
+		}
+	}
+	return res
+}
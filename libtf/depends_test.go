@@ -0,0 +1,91 @@
+package libtf
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const dependsOnConf = `
+service "web" {
+  image   = "web"
+  ecs     = "web"
+  compose = true
+  memory  = 128
+  depends_on {
+    service   = "migrate"
+    condition = "SUCCESS"
+  }
+  depends_on {
+    service   = "db"
+    condition = "HEALTHY"
+  }
+}
+
+service "migrate" {
+  image   = "web"
+  ecs     = "web"
+  memory  = 128
+  depends_on {
+    service = "db"
+  }
+}
+
+service "db" {
+  image   = "postgres"
+  ecs     = "web"
+  compose = true
+  memory  = 128
+  healthcheck {
+    command = ["pg_isready"]
+  }
+}
+`
+
+func TestDependsOn(t *testing.T) {
+	for _, load := range []func(string, *HclConf) error{LoadHclConf, LoadHcl2Conf} {
+		dir := writeConfFiles(t, map[string]string{".tf.hcl": dependsOnConf})
+
+		conf := HclConf{}
+		assert.Nil(t, load(filepath.Join(dir, ".tf.hcl"), &conf))
+		assert.Nil(t, conf.validateDependencies())
+
+		web := conf.Services["web"]
+		assert.Equal(t, []ecsDependency{
+			{ContainerName: "migrate", Condition: "SUCCESS"},
+			{ContainerName: "db", Condition: "HEALTHY"},
+		}, web.ecsDependsOn())
+		assert.Equal(t, map[string]composeDependency{
+			"db": {Condition: "service_healthy"},
+		}, web.composeDependsOn(&conf))
+
+		migrate := conf.Services["migrate"]
+		assert.Equal(t, []ecsDependency{{ContainerName: "db", Condition: "START"}}, migrate.ecsDependsOn())
+		assert.Empty(t, conf.Services["db"].DependsOn)
+
+		migrate.Compose = true
+		conf.Services["migrate"] = migrate
+		err := conf.validateDependencies()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "not supported by compose")
+		migrate.Compose = false
+		conf.Services["migrate"] = migrate
+
+		db := conf.Services["db"]
+		db.DependsOn = []hclConfDependency{{Service: "web"}}
+		conf.Services["db"] = db
+		err = conf.validateDependencies()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "cycle")
+
+		db.DependsOn = []hclConfDependency{{Service: "migrate", Condition: "READY"}}
+		conf.Services["db"] = db
+		assert.Error(t, conf.validateDependencies())
+
+		db.DependsOn = nil
+		db.Healthcheck = nil
+		conf.Services["db"] = db
+		assert.Error(t, conf.validateDependencies())
+	}
+}
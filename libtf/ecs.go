@@ -1,13 +1,19 @@
 package libtf
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"sort"
 	"strings"
 )
 
 type ecsPortMapping struct {
-	ContainerPort int `json:"containerPort"`
+	ContainerPort int    `json:"containerPort"`
+	HostPort      int    `json:"hostPort,omitempty"`
+	Protocol      string `json:"protocol,omitempty"`
 }
 
 type ecsEnvVariable struct {
@@ -29,6 +35,25 @@ func (a byEcsEnvName) Less(i, j int) bool {
 	return strings.Compare(a[i].Name, a[j].Name) == -1
 }
 
+type ecsSecret struct {
+	Name      string `json:"name"`
+	ValueFrom string `json:"valueFrom"`
+}
+
+type byEcsSecretName []ecsSecret
+
+func (a byEcsSecretName) Len() int {
+	return len(a)
+}
+
+func (a byEcsSecretName) Swap(i, j int) {
+	a[i], a[j] = a[j], a[i]
+}
+
+func (a byEcsSecretName) Less(i, j int) bool {
+	return strings.Compare(a[i].Name, a[j].Name) == -1
+}
+
 type byEcsPort []ecsPortMapping
 
 func (a byEcsPort) Len() int {
@@ -43,14 +68,39 @@ func (a byEcsPort) Less(i, j int) bool {
 	return a[i].ContainerPort < a[j].ContainerPort
 }
 
-type ecsLogOptions struct {
-	Group  string `json:"awslogs-group"`
-	Region string `json:"awslogs-region"`
+type ecsUlimit struct {
+	Name      string `json:"name"`
+	SoftLimit int    `json:"softLimit"`
+	HardLimit int    `json:"hardLimit"`
+}
+
+type byEcsUlimitName []ecsUlimit
+
+func (a byEcsUlimitName) Len() int {
+	return len(a)
+}
+
+func (a byEcsUlimitName) Swap(i, j int) {
+	a[i], a[j] = a[j], a[i]
+}
+
+func (a byEcsUlimitName) Less(i, j int) bool {
+	return strings.Compare(a[i].Name, a[j].Name) == -1
+}
+
+type ecsCapabilities struct {
+	Add  []string `json:"add,omitempty"`
+	Drop []string `json:"drop,omitempty"`
+}
+
+type ecsLinuxParameters struct {
+	InitProcessEnabled bool             `json:"initProcessEnabled,omitempty"`
+	Capabilities       *ecsCapabilities `json:"capabilities,omitempty"`
 }
 
 type ecsLogConfiguration struct {
-	LogDriver string        `json:"logDriver"`
-	Options   ecsLogOptions `json:"options"`
+	LogDriver string            `json:"logDriver"`
+	Options   map[string]string `json:"options"`
 }
 
 type EcsServiceConfig struct {
@@ -59,39 +109,60 @@ type EcsServiceConfig struct {
 	Command           []string             `json:"command,omitempty"`
 	Links             []string             `json:"links,omitempty"`
 	Environment       []ecsEnvVariable     `json:"environment,omitempty"`
+	Secrets           []ecsSecret          `json:"secrets,omitempty"`
 	Essential         bool                 `json:"essential"`
 	MemoryReservation int                  `json:"memoryReservation"`
 	PortMappings      []ecsPortMapping     `json:"portMappings,omitempty"`
 	LogConfiguration  *ecsLogConfiguration `json:"logConfiguration,omitempty"`
-	DNSSearchDomains  []string             `json:"dnsSearchDomains"`
+	DNSSearchDomains  []string             `json:"dnsSearchDomains,omitempty"`
+	DNSServers        []string             `json:"dnsServers,omitempty"`
+	ExtraHosts        []ecsHostEntry       `json:"extraHosts,omitempty"`
+	Hostname          string               `json:"hostname,omitempty"`
+	HealthCheck       *ecsHealthCheck      `json:"healthCheck,omitempty"`
+
+	Cpu                    int                 `json:"cpu,omitempty"`
+	Memory                 int                 `json:"memory,omitempty"`
+	Ulimits                []ecsUlimit         `json:"ulimits,omitempty"`
+	StopTimeout            int                 `json:"stopTimeout,omitempty"`
+	User                   string              `json:"user,omitempty"`
+	WorkingDirectory       string              `json:"workingDirectory,omitempty"`
+	EntryPoint             []string            `json:"entryPoint,omitempty"`
+	ReadonlyRootFilesystem bool                `json:"readonlyRootFilesystem,omitempty"`
+	LinuxParameters        *ecsLinuxParameters `json:"linuxParameters,omitempty"`
+
+	MountPoints []ecsMountPoint `json:"mountPoints,omitempty"`
+	VolumesFrom []ecsVolumeFrom `json:"volumesFrom,omitempty"`
+	DependsOn   []ecsDependency `json:"dependsOn,omitempty"`
 }
 
-func (service *hclConfService) asEcs(conf *HclConf, vault Vault) EcsServiceConfig {
+func (service *hclConfService) asEcs(conf *HclConf, vault Vault, secrets map[string]string) EcsServiceConfig {
 	image := service.Image
 	if len(image) == 0 {
 		image = fmt.Sprintf("%s:%s", conf.Global.BaseImage, GetGitVersion())
 	}
+	network := conf.serviceNetwork(service)
 	portMappings := []ecsPortMapping{}
-	for _, port := range service.Ports {
+	ports, _ := service.servicePorts()
+	for _, port := range ports {
+		hostPort, _ := ecsHostPort(network.Mode, port)
 		portMappings = append(portMappings, ecsPortMapping{
-			ContainerPort: port,
+			ContainerPort: port.Container,
+			HostPort:      hostPort,
+			Protocol:      port.Protocol,
 		})
-		sort.Sort(byEcsPort(portMappings))
-	}
-	var logConfigration *ecsLogConfiguration
-	if !service.NoLog {
-		logConfigration = new(ecsLogConfiguration)
-		*logConfigration = ecsLogConfiguration{
-			LogDriver: "awslogs",
-			Options: ecsLogOptions{
-				Group:  fmt.Sprintf("%s-%s", vault.EnvName(), service.Name),
-				Region: vault.AwsRegion(),
-			},
-		}
 	}
+	sort.Sort(byEcsPort(portMappings))
 	env := []ecsEnvVariable{}
+	envSecrets := []ecsSecret{}
 	if !service.NoEnv {
 		for key, value := range vault.Raw {
+			if valueFrom, found := secrets[key]; found {
+				envSecrets = append(envSecrets, ecsSecret{
+					Name:      key,
+					ValueFrom: valueFrom,
+				})
+				continue
+			}
 			env = append(env, ecsEnvVariable{
 				Name:  key,
 				Value: value,
@@ -104,30 +175,95 @@ func (service *hclConfService) asEcs(conf *HclConf, vault Vault) EcsServiceConfi
 			})
 		}
 		sort.Sort(byEcsEnvName(env))
+		sort.Sort(byEcsSecretName(envSecrets))
+	}
+	ulimits := []ecsUlimit{}
+	for name, ulimit := range service.Ulimits {
+		ulimits = append(ulimits, ecsUlimit{
+			Name:      name,
+			SoftLimit: ulimit.Soft,
+			HardLimit: ulimit.Hard,
+		})
+	}
+	sort.Sort(byEcsUlimitName(ulimits))
+	var linuxParameters *ecsLinuxParameters
+	if service.Init || len(service.CapAdd) != 0 || len(service.CapDrop) != 0 {
+		linuxParameters = &ecsLinuxParameters{
+			InitProcessEnabled: service.Init,
+		}
+		if len(service.CapAdd) != 0 || len(service.CapDrop) != 0 {
+			linuxParameters.Capabilities = &ecsCapabilities{
+				Add:  service.CapAdd,
+				Drop: service.CapDrop,
+			}
+		}
 	}
+	command, _ := service.commandArgs()
 	links := []string{}
 	for _, name := range service.Links {
 		_, found := conf.EcsServices[name]
-		if found {
+		if found && network.Mode != "awsvpc" {
 			links = append(links, name)
 		}
 	}
+	for key, value := range conf.discoveryEnv(service, network, false) {
+		env = append(env, ecsEnvVariable{
+			Name:  key,
+			Value: value,
+		})
+	}
+	sort.Sort(byEcsEnvName(env))
 	return EcsServiceConfig{
 		Essential:         true,
 		Name:              service.Name,
 		Image:             image,
-		Command:           strings.Split(service.Command, " "),
+		Command:           command,
 		MemoryReservation: service.Memory,
 		PortMappings:      portMappings,
-		LogConfiguration:  logConfigration,
+		LogConfiguration:  service.ecsLogConfiguration(conf, vault),
 		Environment:       env,
+		Secrets:           envSecrets,
 		Links:             links,
-		DNSSearchDomains:  []string{"internal"},
+		DNSSearchDomains:  network.ecsSearchDomains(),
+		DNSServers:        network.Dns,
+		ExtraHosts:        network.ecsExtraHosts(),
+		Hostname:          network.Hostname,
+		HealthCheck:       service.Healthcheck.asEcs(),
+
+		Cpu:                    service.Cpu,
+		Memory:                 service.MemoryLimit,
+		Ulimits:                ulimits,
+		StopTimeout:            durationSeconds(service.StopTimeout),
+		User:                   service.User,
+		WorkingDirectory:       service.WorkingDir,
+		EntryPoint:             service.Entrypoint,
+		ReadonlyRootFilesystem: service.ReadonlyRoot,
+		LinuxParameters:        linuxParameters,
+
+		MountPoints: service.ecsMountPoints(),
+		VolumesFrom: service.ecsVolumesFrom(),
+		DependsOn:   service.ecsDependsOn(),
 	}
 }
 
-func (conf *HclConf) AsEcs(vault Vault, services map[string][]EcsServiceConfig) {
+func (conf *HclConf) EcsGroups() []string {
+	groups := map[string]bool{}
 	for _, service := range conf.Services {
+		if len(service.Ecs) != 0 {
+			groups[service.Ecs] = true
+		}
+	}
+	res := []string{}
+	for group := range groups {
+		res = append(res, group)
+	}
+	sort.Sort(ByString(res))
+	return res
+}
+
+func (conf *HclConf) AsEcs(vault Vault, secrets map[string]string, services map[string][]EcsServiceConfig) {
+	for _, name := range conf.serviceNames() {
+		service := conf.Services[name]
 		if len(service.Ecs) == 0 {
 			continue
 		}
@@ -135,6 +271,72 @@ func (conf *HclConf) AsEcs(vault Vault, services map[string][]EcsServiceConfig)
 		if !ok {
 			services[service.Ecs] = []EcsServiceConfig{}
 		}
-		services[service.Ecs] = append(services[service.Ecs], service.asEcs(conf, vault))
+		services[service.Ecs] = append(services[service.Ecs], service.asEcs(conf, vault, secrets))
+	}
+}
+
+func (conf *HclConf) renderEcsDefs(vault Vault) (map[string]string, map[string][]byte, error) {
+	secrets, err := conf.EcsSecrets(vault)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	services := map[string][]EcsServiceConfig{}
+	conf.AsEcs(vault, secrets, services)
+
+	vars := map[string]string{}
+	files := map[string][]byte{}
+	for key, value := range services {
+		defs := map[string]interface{}{
+			EcsTemplateVar(key): value,
+		}
+		filenames := map[string]string{
+			EcsTemplateVar(key):  fmt.Sprintf(".ecs-def/%s.json", key),
+			EcsTaskVar(key):      fmt.Sprintf(".ecs-def/%s-task.json", key),
+			EcsLogGroupsVar(key): fmt.Sprintf(".ecs-def/%s-log-groups.json", key),
+			EcsVolumesVar(key):   fmt.Sprintf(".ecs-def/%s-volumes.json", key),
+		}
+		if _, found := conf.EcsTasks[key]; found {
+			defs[EcsTaskVar(key)] = conf.EcsTask(vault, key, value)
+		}
+		if logGroups := conf.EcsLogGroups(vault, key); len(logGroups) != 0 {
+			defs[EcsLogGroupsVar(key)] = logGroups
+		}
+		if volumes := conf.EcsVolumes(key); len(volumes) != 0 {
+			defs[EcsVolumesVar(key)] = volumes
+		}
+
+		for name, def := range defs {
+			data, err := json.MarshalIndent(def, "", "  ")
+			if err != nil {
+				return nil, nil, err
+			}
+			vars[name] = filenames[name]
+			files[filenames[name]] = data
+		}
+	}
+	return vars, files, nil
+}
+
+func (conf *HclConf) WriteEcsDefs(vault Vault, dir string) (map[string]string, error) {
+	vars, files, err := conf.renderEcsDefs(vault)
+	if err != nil {
+		return nil, err
+	}
+
+	defDir := filepath.Join(dir, ".ecs-def")
+	if err := RimRaf(defDir); err != nil {
+		return nil, err
+	}
+
+	if err := os.Mkdir(defDir, 0700); err != nil {
+		return nil, err
+	}
+
+	for filename, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, filename), data, 0600); err != nil {
+			return nil, err
+		}
 	}
+	return vars, nil
 }
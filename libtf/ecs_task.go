@@ -0,0 +1,157 @@
+package libtf
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type hclConfPlacementConstraint struct {
+	Type       string `hcl:"type"`
+	Expression string `hcl:"expression"`
+}
+
+type hclConfEcsTask struct {
+	Family                  string                       `hcl:"family"`
+	TaskRole                string                       `hcl:"task_role"`
+	ExecutionRole           string                       `hcl:"execution_role"`
+	NetworkMode             string                       `hcl:"network_mode"`
+	RequiresCompatibilities []string                     `hcl:"requires_compatibilities"`
+	Cpu                     int                          `hcl:"cpu"`
+	Memory                  int                          `hcl:"memory"`
+	PlacementConstraints    []hclConfPlacementConstraint `hcl:"placement_constraints"`
+}
+
+type ecsPlacementConstraint struct {
+	Type       string `json:"type"`
+	Expression string `json:"expression,omitempty"`
+}
+
+type EcsTaskDefinition struct {
+	Family                  string                   `json:"family"`
+	TaskRoleArn             string                   `json:"taskRoleArn,omitempty"`
+	ExecutionRoleArn        string                   `json:"executionRoleArn,omitempty"`
+	NetworkMode             string                   `json:"networkMode"`
+	RequiresCompatibilities []string                 `json:"requiresCompatibilities,omitempty"`
+	Cpu                     string                   `json:"cpu,omitempty"`
+	Memory                  string                   `json:"memory,omitempty"`
+	ContainerDefinitions    []EcsServiceConfig       `json:"containerDefinitions"`
+	Volumes                 []ecsVolume              `json:"volumes"`
+	PlacementConstraints    []ecsPlacementConstraint `json:"placementConstraints,omitempty"`
+}
+
+type byEcsServiceName []EcsServiceConfig
+
+func (a byEcsServiceName) Len() int {
+	return len(a)
+}
+
+func (a byEcsServiceName) Swap(i, j int) {
+	a[i], a[j] = a[j], a[i]
+}
+
+func (a byEcsServiceName) Less(i, j int) bool {
+	return strings.Compare(a[i].Name, a[j].Name) == -1
+}
+
+func (conf *HclConf) ecsGroupNetworkMode(group string) string {
+	for _, name := range conf.serviceNames() {
+		service := conf.Services[name]
+		if service.Ecs == group {
+			return conf.serviceNetwork(&service).Mode
+		}
+	}
+	return "bridge"
+}
+
+func (task hclConfEcsTask) isFargate() bool {
+	for _, compatibility := range task.RequiresCompatibilities {
+		if compatibility == "FARGATE" {
+			return true
+		}
+	}
+	return false
+}
+
+func (conf *HclConf) validateEcsTasks() error {
+	groups := map[string]bool{}
+	for _, group := range conf.EcsGroups() {
+		groups[group] = true
+	}
+	for group, task := range conf.EcsTasks {
+		if !groups[group] {
+			return fmt.Errorf("ecs_task.%s has no services", group)
+		}
+		mode := conf.ecsGroupNetworkMode(group)
+		if len(task.NetworkMode) != 0 && task.NetworkMode != mode {
+			return fmt.Errorf("ecs_task.%s.network_mode %s doesn't match %s used by its services", group, task.NetworkMode, mode)
+		}
+		for _, compatibility := range task.RequiresCompatibilities {
+			switch compatibility {
+			case "EC2", "FARGATE", "EXTERNAL":
+			default:
+				return fmt.Errorf("ecs_task.%s.requires_compatibilities %s is not one of EC2, FARGATE, EXTERNAL", group, compatibility)
+			}
+		}
+		for _, constraint := range task.PlacementConstraints {
+			if constraint.Type != "memberOf" {
+				return fmt.Errorf("ecs_task.%s.placement_constraints type %s is not memberOf", group, constraint.Type)
+			}
+		}
+		if !task.isFargate() {
+			continue
+		}
+		if mode != "awsvpc" {
+			return fmt.Errorf("ecs_task.%s requires awsvpc network mode on FARGATE", group)
+		}
+		if task.Cpu == 0 || task.Memory == 0 {
+			return fmt.Errorf("ecs_task.%s requires cpu and memory on FARGATE", group)
+		}
+		if len(task.PlacementConstraints) != 0 {
+			return fmt.Errorf("ecs_task.%s placement_constraints are not supported on FARGATE", group)
+		}
+		for _, volume := range conf.EcsVolumes(group) {
+			if volume.EfsVolumeConfiguration == nil {
+				return fmt.Errorf("ecs_task.%s volume %s is not supported on FARGATE, use efs", group, volume.Name)
+			}
+		}
+	}
+	return nil
+}
+
+func intToTaskSize(value int) string {
+	if value == 0 {
+		return ""
+	}
+	return strconv.Itoa(value)
+}
+
+func (conf *HclConf) EcsTask(vault Vault, group string, containers []EcsServiceConfig) EcsTaskDefinition {
+	task := conf.EcsTasks[group]
+	family := task.Family
+	if len(family) == 0 {
+		family = fmt.Sprintf("%s-%s", vault.EnvName(), group)
+	}
+	sorted := append([]EcsServiceConfig{}, containers...)
+	sort.Sort(byEcsServiceName(sorted))
+	constraints := []ecsPlacementConstraint{}
+	for _, constraint := range task.PlacementConstraints {
+		constraints = append(constraints, ecsPlacementConstraint{
+			Type:       constraint.Type,
+			Expression: constraint.Expression,
+		})
+	}
+	return EcsTaskDefinition{
+		Family:                  family,
+		TaskRoleArn:             task.TaskRole,
+		ExecutionRoleArn:        task.ExecutionRole,
+		NetworkMode:             conf.ecsGroupNetworkMode(group),
+		RequiresCompatibilities: task.RequiresCompatibilities,
+		Cpu:                     intToTaskSize(task.Cpu),
+		Memory:                  intToTaskSize(task.Memory),
+		ContainerDefinitions:    sorted,
+		Volumes:                 conf.EcsVolumes(group),
+		PlacementConstraints:    constraints,
+	}
+}
@@ -0,0 +1,93 @@
+package libtf
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEcsTask(t *testing.T) {
+	conf, dir := loadTestConf(t, `
+global {
+  network {
+    mode = "awsvpc"
+  }
+}
+
+volume "media" {
+  efs {
+    file_system_id = "fs-1234"
+  }
+}
+
+ecs_task "web" {
+  task_role                = "arn:aws:iam::1:role/web"
+  execution_role           = "arn:aws:iam::1:role/exec"
+  requires_compatibilities = ["FARGATE"]
+  cpu                      = 512
+  memory                   = 1024
+}
+
+service "web" {
+  image  = "web"
+  ecs    = "web"
+  memory = 256
+  mount "media" {
+    path = "/media"
+  }
+}
+
+service "proxy" {
+  image  = "nginx"
+  ecs    = "web"
+  memory = 64
+}
+`)
+	assert.Nil(t, conf.validateEcsTasks())
+
+	vault := testVault("test")
+	defs, err := conf.WriteEcsDefs(vault, dir)
+	assert.Nil(t, err)
+	assert.Equal(t, ".ecs-def/web.json", defs["ecs_web_template"])
+	assert.Equal(t, ".ecs-def/web-task.json", defs["ecs_web_task"])
+	assert.Equal(t, ".ecs-def/web-volumes.json", defs["ecs_web_volumes"])
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, defs["ecs_web_task"]))
+	assert.Nil(t, err)
+	task := EcsTaskDefinition{}
+	assert.Nil(t, json.Unmarshal(data, &task))
+	assert.Equal(t, "test-web", task.Family)
+	assert.Equal(t, "arn:aws:iam::1:role/web", task.TaskRoleArn)
+	assert.Equal(t, "arn:aws:iam::1:role/exec", task.ExecutionRoleArn)
+	assert.Equal(t, "awsvpc", task.NetworkMode)
+	assert.Equal(t, []string{"FARGATE"}, task.RequiresCompatibilities)
+	assert.Equal(t, "512", task.Cpu)
+	assert.Equal(t, "1024", task.Memory)
+	assert.Equal(t, "proxy", task.ContainerDefinitions[0].Name)
+	assert.Equal(t, "web", task.ContainerDefinitions[1].Name)
+	assert.Equal(t, "fs-1234", task.Volumes[0].EfsVolumeConfiguration.FileSystemId)
+
+	web := conf.EcsTasks["web"]
+	web.Cpu = 0
+	conf.EcsTasks["web"] = web
+	assert.Error(t, conf.validateEcsTasks())
+
+	web.Cpu = 512
+	web.NetworkMode = "bridge"
+	conf.EcsTasks["web"] = web
+	assert.Error(t, conf.validateEcsTasks())
+
+	conf.EcsTasks["web"] = hclConfEcsTask{
+		RequiresCompatibilities: []string{"EC2"},
+		PlacementConstraints:    []hclConfPlacementConstraint{{Type: "memberOf", Expression: "attribute:ecs.instance-type =~ t3.*"}},
+	}
+	assert.Nil(t, conf.validateEcsTasks())
+	assert.Equal(t, []ecsPlacementConstraint{{Type: "memberOf", Expression: "attribute:ecs.instance-type =~ t3.*"}},
+		conf.EcsTask(vault, "web", nil).PlacementConstraints)
+
+	conf.EcsTasks["worker"] = hclConfEcsTask{}
+	assert.Error(t, conf.validateEcsTasks())
+}
@@ -0,0 +1,113 @@
+package libtf
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServiceResources(t *testing.T) {
+	conf, _ := loadTestConf(t, `
+service "web" {
+  image         = "web:latest"
+  ecs           = "web"
+  compose       = true
+  nolog         = true
+  noenv         = true
+  memory        = 256
+  memory_limit  = 512
+  cpu           = 512
+  stop_timeout  = "30s"
+  user          = "app"
+  working_dir   = "/app"
+  entrypoint    = ["/entrypoint.sh"]
+  readonly_root = true
+  init          = true
+  cap_drop      = ["ALL"]
+  ulimit "nproc" {
+    soft = 512
+    hard = 1024
+  }
+  ulimit "nofile" {
+    soft = 1024
+    hard = 4096
+  }
+}
+`)
+	web := conf.Services["web"]
+	vault := testVault("test")
+
+	ecs := web.asEcs(&conf, vault, nil)
+	assert.Equal(t, 512, ecs.Cpu)
+	assert.Equal(t, 256, ecs.MemoryReservation)
+	assert.Equal(t, 512, ecs.Memory)
+	assert.Equal(t, 30, ecs.StopTimeout)
+	assert.Equal(t, "app", ecs.User)
+	assert.Equal(t, "/app", ecs.WorkingDirectory)
+	assert.Equal(t, []string{"/entrypoint.sh"}, ecs.EntryPoint)
+	assert.True(t, ecs.ReadonlyRootFilesystem)
+	assert.Equal(t, []ecsUlimit{
+		{Name: "nofile", SoftLimit: 1024, HardLimit: 4096},
+		{Name: "nproc", SoftLimit: 512, HardLimit: 1024},
+	}, ecs.Ulimits)
+	assert.Equal(t, &ecsLinuxParameters{
+		InitProcessEnabled: true,
+		Capabilities:       &ecsCapabilities{Drop: []string{"ALL"}},
+	}, ecs.LinuxParameters)
+
+	compose := web.asCompose(&conf, vault)
+	assert.Equal(t, 0.5, compose.Cpus)
+	assert.Equal(t, "512m", compose.MemLimit)
+	assert.Equal(t, "30s", compose.StopGracePeriod)
+	assert.Equal(t, "app", compose.User)
+	assert.Equal(t, "/app", compose.WorkingDir)
+	assert.True(t, compose.ReadOnly)
+	assert.True(t, compose.Init)
+	assert.Equal(t, composeUlimit{Soft: 1024, Hard: 4096}, compose.Ulimits["nofile"])
+
+	web.MemoryLimit = 128
+	conf.Services["web"] = web
+	conf.Global = hclConfGlobal{BaseImage: "app", ProjectName: "test"}
+	err := conf.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "memory_limit")
+}
+
+func TestWriteEcsDefsDeterministic(t *testing.T) {
+	conf, dir := loadTestConf(t, `
+service "web" {
+  image = "web:latest"
+  ecs   = "app"
+}
+
+service "worker" {
+  image = "worker:latest"
+  ecs   = "app"
+}
+
+service "cron" {
+  image = "cron:latest"
+  ecs   = "app"
+}
+
+service "api" {
+  image = "api:latest"
+  ecs   = "app"
+}
+`)
+	vault := testVault("test")
+
+	var previous []byte
+	for i := 0; i < 5; i++ {
+		_, err := conf.WriteEcsDefs(vault, dir)
+		assert.Nil(t, err)
+		data, err := ioutil.ReadFile(filepath.Join(dir, ".ecs-def", "app.json"))
+		assert.Nil(t, err)
+		if previous != nil {
+			assert.Equal(t, string(previous), string(data))
+		}
+		previous = data
+	}
+}
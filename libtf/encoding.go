@@ -2,6 +2,7 @@ package libtf
 
 import (
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"strings"
 
@@ -84,32 +85,44 @@ func envStringToDict(input string) (map[string]interface{}, error) {
 	return json_compat.ConvertMap(dict)
 }
 
+func envValueToString(value interface{}) (string, error) {
+	switch value.(type) {
+	case string:
+		return value.(string), nil
+	case bool:
+		return envBoolToString(value.(bool)), nil
+	case int:
+		return envIntToString(value.(int)), nil
+	case []interface{}:
+		return envListToString(value.([]interface{}))
+	case map[string]interface{}:
+		return envDictToString(value.(map[string]interface{}))
+	default:
+		return "", fmt.Errorf("struct value is unsupported: %s", spew.Sdump(value))
+	}
+}
+
+func terraformValueToString(value interface{}) (string, error) {
+	switch value.(type) {
+	case []interface{}, map[string]interface{}:
+		data, err := json.Marshal(value)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	default:
+		return envValueToString(value)
+	}
+}
+
 func structToEnv(input map[string]interface{}) (map[string]string, error) {
 	res := make(map[string]string)
 	for key, value := range input {
-		key = EnvKey(key)
-		switch value.(type) {
-		case string:
-			res[key] = value.(string)
-		case bool:
-			res[key] = envBoolToString(value.(bool))
-		case int:
-			res[key] = envIntToString(value.(int))
-		case []interface{}:
-			list, err := envListToString(value.([]interface{}))
-			if err != nil {
-				return nil, err
-			}
-			res[key] = list
-		case map[string]interface{}:
-			dict, err := envDictToString(value.(map[string]interface{}))
-			if err != nil {
-				return nil, err
-			}
-			res[key] = dict
-		default:
-			return nil, fmt.Errorf("struct value is unsupported: %s", spew.Sdump(value))
+		str, err := envValueToString(value)
+		if err != nil {
+			return nil, err
 		}
+		res[EnvKey(key)] = str
 	}
 	return res, nil
 }
@@ -1,6 +1,7 @@
 package libtf
 
 import (
+	"encoding/json"
 	"reflect"
 	"testing"
 
@@ -71,3 +72,54 @@ func TestDict(t *testing.T) {
 	assert.Nil(t, err2)
 	assert.True(t, reflect.DeepEqual(data1, data2))
 }
+
+func TestTerraformOutputValues(t *testing.T) {
+	outputs := map[string]interface{}{
+		"vpc_id":  "vpc-1",
+		"port":    json.Number("5432"),
+		"ratio":   json.Number("0.5"),
+		"subnets": []interface{}{"a", "b"},
+		"public":  true,
+	}
+	values := map[string]interface{}{}
+	for name, value := range outputs {
+		values[TargetOutputVar("network", name)] = jsonToVaultValue(value)
+	}
+	res, err := structToEnv(values)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{
+		"TF_VAR_network_vpc_id":  "vpc-1",
+		"TF_VAR_network_port":    "5432",
+		"TF_VAR_network_ratio":   "0.5",
+		"TF_VAR_network_subnets": "a,b",
+		"TF_VAR_network_public":  "true",
+	}, res)
+}
+
+func TestTypedTerraformValues(t *testing.T) {
+	outputs := map[string]interface{}{
+		"vpc_id":  "vpc-1",
+		"port":    json.Number("5432"),
+		"subnets": []interface{}{"a", "b"},
+		"zones":   map[string]interface{}{"a": json.Number("1")},
+	}
+	untyped := HclConf{}
+	typed := HclConf{Global: hclConfGlobal{TypedVars: true}}
+	plain := map[string]string{}
+	res := map[string]string{}
+	for name, value := range outputs {
+		str, err := typed.terraformValueToString(jsonToVaultValue(value))
+		assert.Nil(t, err)
+		res[name] = str
+		str, err = untyped.terraformValueToString(jsonToVaultValue(value))
+		assert.Nil(t, err)
+		plain[name] = str
+	}
+	assert.Equal(t, map[string]string{
+		"vpc_id":  "vpc-1",
+		"port":    "5432",
+		"subnets": `["a","b"]`,
+		"zones":   `{"a":1}`,
+	}, res)
+	assert.Equal(t, "a,b", plain["subnets"])
+}
@@ -0,0 +1,70 @@
+package libtf
+
+import (
+	"strings"
+)
+
+func isEnvNameChar(char byte) bool {
+	return char >= 'a' && char <= 'z' || char >= 'A' && char <= 'Z' || char >= '0' && char <= '9'
+}
+
+func replaceEnvName(value string, from string, to string) string {
+	res := []string{}
+	for {
+		idx := strings.Index(value, from)
+		if idx < 0 {
+			break
+		}
+		end := idx + len(from)
+		if (idx == 0 || !isEnvNameChar(value[idx-1])) && (end == len(value) || !isEnvNameChar(value[end])) {
+			res = append(res, value[:idx], to)
+		} else {
+			res = append(res, value[:end])
+		}
+		value = value[end:]
+	}
+	return strings.Join(append(res, value), "")
+}
+
+func replaceEnvNameValue(value interface{}, from string, to string) interface{} {
+	switch value.(type) {
+	case string:
+		return replaceEnvName(value.(string), from, to)
+	case []interface{}:
+		res := []interface{}{}
+		for _, item := range value.([]interface{}) {
+			res = append(res, replaceEnvNameValue(item, from, to))
+		}
+		return res
+	case map[string]interface{}:
+		res := map[string]interface{}{}
+		for key, item := range value.(map[string]interface{}) {
+			res[key] = replaceEnvNameValue(item, from, to)
+		}
+		return res
+	default:
+		return value
+	}
+}
+
+func (conf *HclConf) keepsEnvName(key string) bool {
+	return strings.HasPrefix(key, "aws_") || conf.Env[key].Sensitive
+}
+
+func (conf *HclConf) VaultForEnv(vault Vault, envName string) (*Vault, error) {
+	source := vault.WithoutDefaults()
+	env := map[string]interface{}{}
+	for key, value := range source.Env {
+		if conf.keepsEnvName(key) {
+			env[key] = value
+			continue
+		}
+		env[key] = replaceEnvNameValue(value, vault.EnvName(), envName)
+	}
+	env["env_name"] = envName
+	raw, err := structToEnv(env)
+	if err != nil {
+		return nil, err
+	}
+	return &Vault{Env: env, Raw: raw}, nil
+}
@@ -0,0 +1,45 @@
+package libtf
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplaceEnvName(t *testing.T) {
+	assert.Equal(t, "pr-42-db.internal", replaceEnvName("staging-db.internal", "staging", "pr-42"))
+	assert.Equal(t, "/pr-42/app/pr-42", replaceEnvName("/staging/app/staging", "staging", "pr-42"))
+	assert.Equal(t, "stagingdb", replaceEnvName("stagingdb", "staging", "pr-42"))
+	assert.Equal(t, "mystaging", replaceEnvName("mystaging", "staging", "pr-42"))
+	assert.Equal(t, "device", replaceEnvName("device", "dev", "pr-42"))
+}
+
+func TestVaultForEnv(t *testing.T) {
+	conf := HclConf{
+		Env: map[string]hclConfVariable{
+			"db_password": {Type: "string", Sensitive: true},
+		},
+	}
+	vault := Vault{
+		Env: map[string]interface{}{
+			"env_name":    "staging",
+			"aws_key":     "staging-key",
+			"db_host":     "staging.db.internal",
+			"db_password": "staging-secret",
+			"replicas":    2,
+			"hosts":       []interface{}{"a.staging.internal"},
+			"git_version": "abc",
+		},
+	}
+	preview, err := conf.VaultForEnv(vault, "pr-42")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"env_name":    "pr-42",
+		"aws_key":     "staging-key",
+		"db_host":     "pr-42.db.internal",
+		"db_password": "staging-secret",
+		"replicas":    2,
+		"hosts":       []interface{}{"a.pr-42.internal"},
+	}, preview.Env)
+	assert.Equal(t, "pr-42", preview.Raw["TF_VAR_env_name"])
+}
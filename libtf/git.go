@@ -37,3 +37,35 @@ func GetGitVersion() string {
 	gitVersion = fmt.Sprint(head.Hash())
 	return gitVersion
 }
+
+func gitStatusIsClean(status git.Status) bool {
+	for _, file := range status {
+		if file.Staging == git.Untracked && file.Worktree == git.Untracked {
+			continue
+		}
+		if file.Staging != git.Unmodified || file.Worktree != git.Unmodified {
+			return false
+		}
+	}
+	return true
+}
+
+func GitIsClean() (bool, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return false, err
+	}
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return true, nil
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return false, err
+	}
+	status, err := worktree.Status()
+	if err != nil {
+		return false, err
+	}
+	return gitStatusIsClean(status), nil
+}
@@ -0,0 +1,368 @@
+package libtf
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/hashicorp/hcl/hcl/token"
+	hcl2 "github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+	"github.com/zclconf/go-cty/cty/function/stdlib"
+)
+
+type hcl2ConfFile struct {
+	filename string
+	body     *hclsyntax.Body
+}
+
+var hcl2Functions = map[string]function.Function{
+	"abs":        stdlib.AbsoluteFunc,
+	"ceil":       stdlib.CeilFunc,
+	"coalesce":   stdlib.CoalesceFunc,
+	"concat":     stdlib.ConcatFunc,
+	"contains":   stdlib.ContainsFunc,
+	"distinct":   stdlib.DistinctFunc,
+	"flatten":    stdlib.FlattenFunc,
+	"floor":      stdlib.FloorFunc,
+	"format":     stdlib.FormatFunc,
+	"join":       stdlib.JoinFunc,
+	"jsondecode": stdlib.JSONDecodeFunc,
+	"jsonencode": stdlib.JSONEncodeFunc,
+	"keys":       stdlib.KeysFunc,
+	"length":     stdlib.LengthFunc,
+	"lookup":     stdlib.LookupFunc,
+	"lower":      stdlib.LowerFunc,
+	"max":        stdlib.MaxFunc,
+	"merge":      stdlib.MergeFunc,
+	"min":        stdlib.MinFunc,
+	"range":      stdlib.RangeFunc,
+	"replace":    stdlib.ReplaceFunc,
+	"split":      stdlib.SplitFunc,
+	"substr":     stdlib.SubstrFunc,
+	"trimspace":  stdlib.TrimSpaceFunc,
+	"upper":      stdlib.UpperFunc,
+	"values":     stdlib.ValuesFunc,
+}
+
+func hcl2Include(file hcl2ConfFile) ([]string, error) {
+	attr, found := file.body.Attributes["include"]
+	if !found {
+		return nil, nil
+	}
+	value, diags := attr.Expr.Value(&hcl2.EvalContext{Functions: hcl2Functions})
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	include, err := ctyToGo(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s: include: %s", file.filename, err)
+	}
+	patterns := []string{}
+	items, ok := include.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: include must be a list of strings", file.filename)
+	}
+	for _, item := range items {
+		pattern, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s: include must be a list of strings", file.filename)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+func collectHcl2Files(parser *hclparse.Parser, filename string, loaded map[string]bool, files *[]hcl2ConfFile) error {
+	absFilename, err := filepath.Abs(filename)
+	if err != nil {
+		return err
+	}
+	if loaded[absFilename] {
+		return nil
+	}
+	loaded[absFilename] = true
+
+	parsed, diags := parser.ParseHCLFile(filename)
+	if diags.HasErrors() {
+		return diags
+	}
+	file := hcl2ConfFile{filename: filename, body: parsed.Body.(*hclsyntax.Body)}
+	*files = append(*files, file)
+
+	patterns, err := hcl2Include(file)
+	if err != nil {
+		return err
+	}
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(filepath.Join(filepath.Dir(filename), pattern))
+		if err != nil {
+			return fmt.Errorf("%s: invalid include %s: %s", filename, pattern, err)
+		}
+		if len(matches) == 0 && !strings.ContainsAny(pattern, "*?[") {
+			return fmt.Errorf("%s: included file %s does not exist", filename, pattern)
+		}
+		for _, match := range matches {
+			if err := collectHcl2Files(parser, match, loaded, files); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (conf *HclConf) hcl2EvalContext(files []hcl2ConfFile) (*hcl2.EvalContext, error) {
+	vars := map[string]cty.Value{}
+	for _, file := range files {
+		for _, block := range file.body.Blocks {
+			if block.Type != "variable" {
+				continue
+			}
+			if len(block.Labels) != 1 {
+				return nil, fmt.Errorf("%s: variable block must have exactly one label", block.DefRange().String())
+			}
+			name := block.Labels[0]
+			if err := conf.setOrigin(fmt.Sprintf("variable.%s", name), file.filename); err != nil {
+				return nil, err
+			}
+			attr, found := block.Body.Attributes["default"]
+			if !found {
+				return nil, fmt.Errorf("%s: variable.%s.default is not defined", block.DefRange().String(), name)
+			}
+			value, diags := attr.Expr.Value(&hcl2.EvalContext{Functions: hcl2Functions})
+			if diags.HasErrors() {
+				return nil, diags
+			}
+			vars[name] = value
+		}
+	}
+	return &hcl2.EvalContext{
+		Variables: map[string]cty.Value{"var": cty.ObjectVal(vars)},
+		Functions: hcl2Functions,
+	}, nil
+}
+
+func ctyToGo(value cty.Value) (interface{}, error) {
+	if value.IsNull() {
+		return nil, nil
+	}
+	if !value.IsWhollyKnown() {
+		return nil, fmt.Errorf("value is not known")
+	}
+	valueType := value.Type()
+	switch {
+	case valueType == cty.String:
+		return value.AsString(), nil
+	case valueType == cty.Bool:
+		return value.True(), nil
+	case valueType == cty.Number:
+		number := value.AsBigFloat()
+		if number.IsInt() {
+			intValue, accuracy := number.Int64()
+			if accuracy == big.Exact {
+				return int(intValue), nil
+			}
+		}
+		floatValue, _ := number.Float64()
+		return floatValue, nil
+	case valueType.IsListType() || valueType.IsTupleType() || valueType.IsSetType():
+		res := []interface{}{}
+		for it := value.ElementIterator(); it.Next(); {
+			_, item := it.Element()
+			converted, err := ctyToGo(item)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, converted)
+		}
+		return res, nil
+	case valueType.IsMapType() || valueType.IsObjectType():
+		res := map[string]interface{}{}
+		for it := value.ElementIterator(); it.Next(); {
+			key, item := it.Element()
+			converted, err := ctyToGo(item)
+			if err != nil {
+				return nil, err
+			}
+			res[key.AsString()] = converted
+		}
+		return res, nil
+	default:
+		return nil, fmt.Errorf("unsupported value type %s", valueType.FriendlyName())
+	}
+}
+
+func hcl2Pos(pos hcl2.Pos, filename string) token.Pos {
+	return token.Pos{Filename: filename, Offset: pos.Byte, Line: pos.Line, Column: pos.Column}
+}
+
+func hcl2Literal(value interface{}, pos token.Pos) (ast.Node, error) {
+	switch value.(type) {
+	case map[string]interface{}:
+		object := value.(map[string]interface{})
+		keys := []string{}
+		for key := range object {
+			keys = append(keys, key)
+		}
+		sort.Sort(ByString(keys))
+		list := &ast.ObjectList{}
+		for _, key := range keys {
+			if object[key] == nil {
+				continue
+			}
+			node, err := hcl2Literal(object[key], pos)
+			if err != nil {
+				return nil, err
+			}
+			list.Add(&ast.ObjectItem{Keys: []*ast.ObjectKey{hcl2Key(key, pos)}, Assign: pos, Val: node})
+		}
+		return &ast.ObjectType{Lbrace: pos, Rbrace: pos, List: list}, nil
+	case []interface{}:
+		list := &ast.ListType{Lbrack: pos, Rbrack: pos}
+		for _, item := range value.([]interface{}) {
+			node, err := hcl2Literal(item, pos)
+			if err != nil {
+				return nil, err
+			}
+			list.Add(node)
+		}
+		return list, nil
+	case string:
+		return &ast.LiteralType{Token: token.Token{Type: token.STRING, Pos: pos, Text: strconv.Quote(value.(string)), JSON: true}}, nil
+	case int:
+		return &ast.LiteralType{Token: token.Token{Type: token.NUMBER, Pos: pos, Text: strconv.Itoa(value.(int))}}, nil
+	case float64:
+		return &ast.LiteralType{Token: token.Token{Type: token.FLOAT, Pos: pos, Text: strconv.FormatFloat(value.(float64), 'f', -1, 64)}}, nil
+	case bool:
+		return &ast.LiteralType{Token: token.Token{Type: token.BOOL, Pos: pos, Text: strconv.FormatBool(value.(bool))}}, nil
+	default:
+		return nil, fmt.Errorf("unsupported value %#v", value)
+	}
+}
+
+func hcl2Key(name string, pos token.Pos) *ast.ObjectKey {
+	return &ast.ObjectKey{Token: token.Token{Type: token.STRING, Pos: pos, Text: strconv.Quote(name), JSON: true}}
+}
+
+func hcl2ObjectList(filename string, body *hclsyntax.Body, ctx *hcl2.EvalContext, skip map[string]bool) (*ast.ObjectList, error) {
+	names := []string{}
+	for name := range body.Attributes {
+		if !skip[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Sort(ByString(names))
+	list := &ast.ObjectList{}
+	for _, name := range names {
+		attr := body.Attributes[name]
+		value, diags := attr.Expr.Value(ctx)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+		converted, err := ctyToGo(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %s", attr.SrcRange.String(), name, err)
+		}
+		if converted == nil {
+			continue
+		}
+		pos := hcl2Pos(attr.Expr.Range().Start, filename)
+		node, err := hcl2Literal(converted, pos)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %s", attr.SrcRange.String(), name, err)
+		}
+		list.Add(&ast.ObjectItem{Keys: []*ast.ObjectKey{hcl2Key(name, hcl2Pos(attr.NameRange.Start, filename))}, Assign: pos, Val: node})
+	}
+	seen := map[string]bool{}
+	for _, block := range body.Blocks {
+		if skip[block.Type] {
+			continue
+		}
+		if len(block.Labels) != 0 {
+			name := strings.Join(append([]string{block.Type}, block.Labels...), ".")
+			if seen[name] {
+				return nil, fmt.Errorf("%s: %s is defined twice", block.DefRange().String(), name)
+			}
+			seen[name] = true
+		}
+		nested, err := hcl2ObjectList(filename, block.Body, ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		pos := hcl2Pos(block.TypeRange.Start, filename)
+		keys := []*ast.ObjectKey{hcl2Key(block.Type, pos)}
+		for idx, label := range block.Labels {
+			keys = append(keys, hcl2Key(label, hcl2Pos(block.LabelRanges[idx].Start, filename)))
+		}
+		list.Add(&ast.ObjectItem{Keys: keys, Val: &ast.ObjectType{
+			Lbrace: hcl2Pos(block.OpenBraceRange.Start, filename),
+			Rbrace: hcl2Pos(block.CloseBraceRange.Start, filename),
+			List:   nested,
+		}})
+	}
+	return list, nil
+}
+
+func decodeHcl2ConfPart(file hcl2ConfFile, ctx *hcl2.EvalContext, part *HclConf) error {
+	list, err := hcl2ObjectList(file.filename, file.body, ctx, map[string]bool{"variable": true})
+	if err != nil {
+		return err
+	}
+	if err := decodeHclConfRoot(&ast.File{Node: list}, part); err != nil {
+		return fmt.Errorf("%s: %s", file.filename, err)
+	}
+	return nil
+}
+
+func isHcl2File(filename string) (bool, error) {
+	if strings.HasSuffix(filename, ".hcl2") {
+		return true, nil
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return false, err
+	}
+	if _, err := hcl.ParseBytes(data); err == nil {
+		return false, nil
+	}
+	_, diags := hclsyntax.ParseConfig(data, filename, hcl2.Pos{Line: 1, Column: 1})
+	return !diags.HasErrors(), nil
+}
+
+func LoadHcl2Conf(filename string, conf *HclConf) error {
+	filenames, err := hclConfFiles(filename)
+	if err != nil {
+		return err
+	}
+	parser := hclparse.NewParser()
+	loaded := map[string]bool{}
+	files := []hcl2ConfFile{}
+	for _, filename := range filenames {
+		if err := collectHcl2Files(parser, filename, loaded, &files); err != nil {
+			return err
+		}
+	}
+	ctx, err := conf.hcl2EvalContext(files)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		part := HclConf{}
+		if err := decodeHcl2ConfPart(file, ctx, &part); err != nil {
+			return err
+		}
+		if err := conf.merge(&part, file.filename); err != nil {
+			return err
+		}
+	}
+	return conf.finish()
+}
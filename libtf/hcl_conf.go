@@ -4,52 +4,119 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 	"sort"
 	"strings"
-
-	"github.com/hashicorp/hcl"
+	"time"
 )
 
 type hclConfVariable struct {
-	Type     string `hcl:"type"`
-	Optional bool   `hcl:"optional"`
+	Type        string `hcl:"type"`
+	Optional    bool   `hcl:"optional"`
+	Description string `hcl:"description"`
+	Sensitive   bool   `hcl:"sensitive"`
 }
 
 type hclConfService struct {
 	Name    string            `hcl:"name"`
 	Image   string            `hcl:"image"`
 	Ecs     string            `hcl:"ecs"`
-	Command string            `hcl:"command"`
+	Command interface{}       `hcl:"command"`
 	Compose bool              `hcl:"compose"`
 	Memory  int               `hcl:"memory"`
 	NoEnv   bool              `hcl:"noenv"`
 	NoLog   bool              `hcl:"nolog"`
 	Env     map[string]string `hcl:"env"`
 	Links   []string          `hcl:"links"`
-	Ports   []int             `hcl:"ports"`
+	Ports   []interface{}     `hcl:"ports"`
+
+	PortDefs     map[string]hclConfPort   `hcl:"port"`
+	Mounts       map[string]hclConfMount  `hcl:"mount"`
+	VolumesFrom  []string                 `hcl:"volumes_from"`
+	Cpu          int                      `hcl:"cpu"`
+	MemoryLimit  int                      `hcl:"memory_limit"`
+	Ulimits      map[string]hclConfUlimit `hcl:"ulimit"`
+	StopTimeout  string                   `hcl:"stop_timeout"`
+	User         string                   `hcl:"user"`
+	WorkingDir   string                   `hcl:"working_dir"`
+	Entrypoint   []string                 `hcl:"entrypoint"`
+	ReadonlyRoot bool                     `hcl:"readonly_root"`
+	Init         bool                     `hcl:"init"`
+	CapAdd       []string                 `hcl:"cap_add"`
+	CapDrop      []string                 `hcl:"cap_drop"`
+
+	Healthcheck *hclConfHealthcheck `hcl:"healthcheck"`
+	Logging     *hclConfLogging     `hcl:"logging"`
+	Network     *hclConfNetwork     `hcl:"network"`
+	DependsOn   []hclConfDependency
+}
+
+type hclConfUlimit struct {
+	Soft int `hcl:"soft"`
+	Hard int `hcl:"hard"`
+}
+
+type hclConfTarget struct {
+	Name             string
+	Path             string   `hcl:"path"`
+	DependsOn        []string `hcl:"depends_on"`
+	DeclaredVarsOnly bool     `hcl:"declared_vars_only"`
 }
 
 type hclConfGlobal struct {
-	BaseImage   string `hcl:"base_image"`
-	ProjectName string `hcl:"project_name"`
+	BaseImage        string `hcl:"base_image"`
+	ProjectName      string `hcl:"project_name"`
+	Workspaces       bool   `hcl:"workspaces"`
+	DeclaredVarsOnly bool   `hcl:"declared_vars_only"`
+	TypedVars        bool   `hcl:"typed_vars"`
+	Secrets          string `hcl:"secrets"`
+
+	Network hclConfNetwork `hcl:"network"`
 }
 
 type HclConf struct {
 	Keys          map[string]string
+	Include       []string                   `hcl:"include"`
 	Global        hclConfGlobal              `hcl:"global"`
 	Services      map[string]hclConfService  `hcl:"service"`
 	Env           map[string]hclConfVariable `hcl:"env"`
+	TargetDefs    map[string]hclConfTarget   `hcl:"target"`
+	Backend       map[string]hclConfBackend  `hcl:"backend"`
+	Policies      map[string]hclConfPolicy   `hcl:"policy"`
+	Volumes       map[string]hclConfVolume   `hcl:"volume"`
+	Logging       map[string]hclConfLogging  `hcl:"logging"`
+	EcsTasks      map[string]hclConfEcsTask  `hcl:"ecs_task"`
+	ProtectedEnvs []string                   `hcl:"protected_envs"`
 	Targets       []string
 	SortedEnvKeys []string
 	EcsServices   map[string]bool
+
+	origins map[string]string
 }
 
-var hclConfDefaultEnv = []string{
-	"env_name",
-	"aws_key",
-	"aws_secret",
-	"aws_region",
-	"tf_state_bucket",
+var hclConfDefaultEnv = map[string]hclConfVariable{
+	"env_name": {
+		Type:        "string",
+		Description: "environment name",
+	},
+	"aws_key": {
+		Type:        "string",
+		Description: "aws access key id",
+	},
+	"aws_secret": {
+		Type:        "string",
+		Description: "aws secret access key",
+	},
+	"aws_region": {
+		Type:        "string",
+		Description: "aws region",
+	},
+	"tf_state_lock_table": {
+		Type:        "string",
+		Optional:    true,
+		Description: "dynamodb table for terraform state locking",
+	},
 }
 
 type ByString []string
@@ -66,45 +133,256 @@ func (a ByString) Less(i, j int) bool {
 	return strings.Compare(a[i], a[j]) == -1
 }
 
-func LoadHclConf(filename string, conf *HclConf) error {
+func (conf *HclConf) serviceNames() []string {
+	res := []string{}
+	for name := range conf.Services {
+		res = append(res, name)
+	}
+	sort.Sort(ByString(res))
+	return res
+}
+
+func hclConfFiles(filename string) ([]string, error) {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{filename}, nil
+	}
+	files, err := filepath.Glob(filepath.Join(filename, "*.hcl"))
+	if err != nil {
+		return nil, err
+	}
+	hcl2Files, err := filepath.Glob(filepath.Join(filename, "*.hcl2"))
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, hcl2Files...)
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no *.hcl or *.hcl2 files found in %s", filename)
+	}
+	return files, nil
+}
+
+func (conf *HclConf) setOrigin(key string, filename string) error {
+	if conf.origins == nil {
+		conf.origins = map[string]string{}
+	}
+	if previous, found := conf.origins[key]; found {
+		return fmt.Errorf("%s is defined in both %s and %s", key, previous, filename)
+	}
+	conf.origins[key] = filename
+	return nil
+}
+
+func (conf *HclConf) merge(part *HclConf, filename string) error {
+	if len(part.Global.BaseImage) != 0 {
+		if err := conf.setOrigin("global.base_image", filename); err != nil {
+			return err
+		}
+		conf.Global.BaseImage = part.Global.BaseImage
+	}
+	if len(part.Global.ProjectName) != 0 {
+		if err := conf.setOrigin("global.project_name", filename); err != nil {
+			return err
+		}
+		conf.Global.ProjectName = part.Global.ProjectName
+	}
+	if part.Global.Workspaces {
+		if err := conf.setOrigin("global.workspaces", filename); err != nil {
+			return err
+		}
+		conf.Global.Workspaces = true
+	}
+	if len(part.Global.Secrets) != 0 {
+		if err := conf.setOrigin("global.secrets", filename); err != nil {
+			return err
+		}
+		conf.Global.Secrets = part.Global.Secrets
+	}
+	if part.Global.Network.isSet() {
+		if err := conf.setOrigin("global.network", filename); err != nil {
+			return err
+		}
+		conf.Global.Network = part.Global.Network
+	}
+	if part.Global.DeclaredVarsOnly {
+		if err := conf.setOrigin("global.declared_vars_only", filename); err != nil {
+			return err
+		}
+		conf.Global.DeclaredVarsOnly = true
+	}
+	if part.Global.TypedVars {
+		if err := conf.setOrigin("global.typed_vars", filename); err != nil {
+			return err
+		}
+		conf.Global.TypedVars = true
+	}
+	if conf.Services == nil {
+		conf.Services = map[string]hclConfService{}
+	}
+	for name, service := range part.Services {
+		if err := conf.setOrigin(fmt.Sprintf("service.%s", name), filename); err != nil {
+			return err
+		}
+		conf.Services[name] = service
+	}
+	if conf.Env == nil {
+		conf.Env = map[string]hclConfVariable{}
+	}
+	for name, variable := range part.Env {
+		if err := conf.setOrigin(fmt.Sprintf("env.%s", name), filename); err != nil {
+			return err
+		}
+		conf.Env[name] = variable
+	}
+	if conf.Backend == nil {
+		conf.Backend = map[string]hclConfBackend{}
+	}
+	for backendType, backend := range part.Backend {
+		if err := conf.setOrigin("backend", filename); err != nil {
+			return err
+		}
+		conf.Backend[backendType] = backend
+	}
+	conf.ProtectedEnvs = append(conf.ProtectedEnvs, part.ProtectedEnvs...)
+	if conf.Volumes == nil {
+		conf.Volumes = map[string]hclConfVolume{}
+	}
+	for name, volume := range part.Volumes {
+		if err := conf.setOrigin(fmt.Sprintf("volume.%s", name), filename); err != nil {
+			return err
+		}
+		conf.Volumes[name] = volume
+	}
+	if conf.EcsTasks == nil {
+		conf.EcsTasks = map[string]hclConfEcsTask{}
+	}
+	for name, task := range part.EcsTasks {
+		if err := conf.setOrigin(fmt.Sprintf("ecs_task.%s", name), filename); err != nil {
+			return err
+		}
+		conf.EcsTasks[name] = task
+	}
+	if conf.Logging == nil {
+		conf.Logging = map[string]hclConfLogging{}
+	}
+	for name, logging := range part.Logging {
+		if err := conf.setOrigin(fmt.Sprintf("logging.%s", name), filename); err != nil {
+			return err
+		}
+		conf.Logging[name] = logging
+	}
+	if conf.Policies == nil {
+		conf.Policies = map[string]hclConfPolicy{}
+	}
+	for name, policy := range part.Policies {
+		if err := conf.setOrigin(fmt.Sprintf("policy.%s", name), filename); err != nil {
+			return err
+		}
+		conf.Policies[name] = policy
+	}
+	if conf.TargetDefs == nil {
+		conf.TargetDefs = map[string]hclConfTarget{}
+	}
+	for name, target := range part.TargetDefs {
+		if err := conf.setOrigin(fmt.Sprintf("target.%s", name), filename); err != nil {
+			return err
+		}
+		conf.TargetDefs[name] = target
+	}
+	return nil
+}
+
+func (conf *HclConf) loadFile(filename string, loaded map[string]bool) error {
+	absFilename, err := filepath.Abs(filename)
+	if err != nil {
+		return err
+	}
+	if loaded[absFilename] {
+		return nil
+	}
+	loaded[absFilename] = true
+
 	data, err := ioutil.ReadFile(filename)
 	if err != nil {
 		return err
 	}
-	if err := hcl.Unmarshal(data, conf); err != nil {
+	part := HclConf{}
+	if err := decodeHclConfPart(data, &part); err != nil {
+		return fmt.Errorf("%s: %s", filename, err)
+	}
+	if err := conf.merge(&part, filename); err != nil {
 		return err
 	}
+
+	for _, pattern := range part.Include {
+		matches, err := filepath.Glob(filepath.Join(filepath.Dir(filename), pattern))
+		if err != nil {
+			return fmt.Errorf("%s: invalid include %s: %s", filename, pattern, err)
+		}
+		if len(matches) == 0 && !strings.ContainsAny(pattern, "*?[") {
+			return fmt.Errorf("%s: included file %s does not exist", filename, pattern)
+		}
+		for _, match := range matches {
+			if err := conf.loadFile(match, loaded); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func LoadHclConf(filename string, conf *HclConf) error {
+	files, err := hclConfFiles(filename)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		hcl2, err := isHcl2File(file)
+		if err != nil {
+			return err
+		}
+		if hcl2 {
+			return LoadHcl2Conf(filename, conf)
+		}
+	}
+	loaded := map[string]bool{}
+	for _, file := range files {
+		if err := conf.loadFile(file, loaded); err != nil {
+			return err
+		}
+	}
+	return conf.finish()
+}
+
+func (conf *HclConf) finish() error {
 	conf.EcsServices = map[string]bool{}
 	for name, service := range conf.Services {
 		if len(service.Ecs) != 0 {
 			conf.EcsServices[name] = true
 		}
-		conf.Services[name] = hclConfService{
-			Name:    name,
-			Image:   service.Image,
-			Ecs:     service.Ecs,
-			Command: service.Command,
-			Compose: service.Compose,
-			Memory:  service.Memory,
-			NoEnv:   service.NoEnv,
-			NoLog:   service.NoLog,
-			Env:     service.Env,
-			Links:   service.Links,
-			Ports:   service.Ports,
-		}
+		service.Name = name
+		conf.Services[name] = service
+	}
+	for name, volume := range conf.Volumes {
+		volume.Name = name
+		conf.Volumes[name] = volume
 	}
 	for name, variable := range conf.Env {
 		if len(variable.Type) == 0 {
-			conf.Env[name] = hclConfVariable{
-				Type:     "string",
-				Optional: variable.Optional,
-			}
+			variable.Type = "string"
+			conf.Env[name] = variable
 		}
 	}
-	for _, name := range hclConfDefaultEnv {
-		conf.Env[name] = hclConfVariable{
-			Type: "string",
-		}
+	for name, variable := range hclConfDefaultEnv {
+		conf.Env[name] = variable
+	}
+	conf.Env["tf_state_bucket"] = hclConfVariable{
+		Type:        "string",
+		Optional:    !conf.usesVaultStateBucket(),
+		Description: "s3 bucket for terraform state",
 	}
 	sortedEnvKeys := make([]string, len(conf.Env))
 	idx := 0
@@ -114,7 +392,26 @@ func LoadHclConf(filename string, conf *HclConf) error {
 	}
 	sort.Sort(ByString(sortedEnvKeys))
 	conf.SortedEnvKeys = sortedEnvKeys
-	conf.Targets = findTerraformTargets()
+	if len(conf.TargetDefs) == 0 {
+		targets, err := findTerraformTargets()
+		if err != nil {
+			return err
+		}
+		conf.TargetDefs = map[string]hclConfTarget{}
+		for _, name := range targets {
+			conf.TargetDefs[name] = hclConfTarget{}
+		}
+	}
+	conf.Targets = []string{}
+	for name, target := range conf.TargetDefs {
+		target.Name = name
+		if len(target.Path) == 0 {
+			target.Path = name
+		}
+		conf.TargetDefs[name] = target
+		conf.Targets = append(conf.Targets, name)
+	}
+	sort.Sort(ByString(conf.Targets))
 	return nil
 }
 
@@ -136,7 +433,7 @@ func (conf *HclConf) Validate() error {
 
 	for index, service := range conf.Services {
 		if len(service.Name) == 0 {
-			return fmt.Errorf("services[%d].name is not defined", index)
+			return fmt.Errorf("services[%s].name is not defined", index)
 		}
 		if len(service.Ecs) == 0 && !service.Compose {
 			return fmt.Errorf("both compose and ecs disabled for service.%s", service.Name)
@@ -144,6 +441,84 @@ func (conf *HclConf) Validate() error {
 		if len(service.Ecs) != 0 && service.Memory == 0 {
 			return fmt.Errorf("services.%s.memory is not defined", service.Name)
 		}
+		if _, err := service.commandArgs(); err != nil {
+			return fmt.Errorf("services.%s.command is invalid: %s", service.Name, err)
+		}
+		if service.MemoryLimit != 0 && service.MemoryLimit < service.Memory {
+			return fmt.Errorf("services.%s.memory_limit is less than memory", service.Name)
+		}
+		if len(service.StopTimeout) != 0 {
+			if _, err := time.ParseDuration(service.StopTimeout); err != nil {
+				return fmt.Errorf("services.%s.stop_timeout is invalid: %s", service.Name, err)
+			}
+		}
+		for name, ulimit := range service.Ulimits {
+			if ulimit.Hard < ulimit.Soft {
+				return fmt.Errorf("services.%s.ulimit.%s hard is less than soft", service.Name, name)
+			}
+		}
+		if service.Healthcheck != nil {
+			if err := service.Healthcheck.validate(); err != nil {
+				return fmt.Errorf("services.%s.healthcheck %s", service.Name, err)
+			}
+		}
+	}
+
+	for _, name := range conf.Targets {
+		target := conf.TargetDefs[name]
+		isTarget, err := isTerraformTarget(target.Path)
+		if err != nil {
+			return fmt.Errorf("target.%s.path is invalid: %s", name, err)
+		}
+		if !isTarget {
+			return fmt.Errorf("target.%s.path %s contains no *.tf files", name, target.Path)
+		}
+		for _, dependency := range target.DependsOn {
+			if dependency == name {
+				return fmt.Errorf("target.%s depends on itself", name)
+			}
+			if _, found := conf.TargetDefs[dependency]; !found {
+				return fmt.Errorf("target.%s depends on unknown target %s", name, dependency)
+			}
+		}
+	}
+
+	if err := conf.validateDependencies(); err != nil {
+		return err
+	}
+
+	if err := conf.validateNetwork(); err != nil {
+		return err
+	}
+
+	if err := conf.validatePorts(); err != nil {
+		return err
+	}
+
+	if err := conf.validateVolumes(); err != nil {
+		return err
+	}
+
+	if err := conf.validateEcsTasks(); err != nil {
+		return err
+	}
+
+	switch conf.Global.Secrets {
+	case "", "ssm", "secretsmanager":
+	default:
+		return fmt.Errorf("global.secrets %s is not one of ssm, secretsmanager", conf.Global.Secrets)
+	}
+
+	if _, err := conf.TargetOrder(); err != nil {
+		return err
+	}
+
+	if _, err := conf.StateBackend(); err != nil {
+		return err
+	}
+
+	if _, err := conf.compilePolicies(); err != nil {
+		return err
 	}
 
 	for name, variable := range conf.Env {
@@ -0,0 +1,322 @@
+package libtf
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeConfFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "tf-conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	for name, content := range files {
+		filename := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filename, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func loadTestConf(t *testing.T, src string) (HclConf, string) {
+	dir := writeConfFiles(t, map[string]string{".tf.hcl": src})
+	conf := HclConf{}
+	if err := LoadHclConf(filepath.Join(dir, ".tf.hcl"), &conf); err != nil {
+		t.Fatal(err)
+	}
+	return conf, dir
+}
+
+func testVault(envName string) Vault {
+	return Vault{Env: map[string]interface{}{"env_name": envName, "aws_region": "us-east-1"}, Raw: map[string]string{}}
+}
+
+func TestLoadConfDir(t *testing.T) {
+	dir := writeConfFiles(t, map[string]string{
+		"global.hcl": `
+global {
+  base_image = "app"
+  project_name = "test"
+  typed_vars = true
+}
+include = ["services/*.hcl"]
+`,
+		"env.hcl":          `env "db_password" {}`,
+		"services/web.hcl": `service "web" { compose = true }`,
+		"services/db.hcl":  `service "db" { compose = true }`,
+	})
+
+	conf := HclConf{}
+	assert.Nil(t, LoadHclConf(dir, &conf))
+	assert.Equal(t, "app", conf.Global.BaseImage)
+	assert.Equal(t, "test", conf.Global.ProjectName)
+	assert.True(t, conf.Global.TypedVars)
+	assert.Equal(t, "web", conf.Services["web"].Name)
+	assert.Equal(t, "db", conf.Services["db"].Name)
+	assert.Contains(t, conf.SortedEnvKeys, "db_password")
+}
+
+func TestLoadConfDuplicate(t *testing.T) {
+	dir := writeConfFiles(t, map[string]string{
+		"a.hcl":   `service "web" { compose = true }`,
+		"b.hcl":   `include = ["c/b.hcl"]`,
+		"c/b.hcl": `service "web" { compose = true }`,
+	})
+
+	conf := HclConf{}
+	err := LoadHclConf(dir, &conf)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), filepath.Join(dir, "a.hcl"))
+	assert.Contains(t, err.Error(), filepath.Join(dir, "c", "b.hcl"))
+}
+
+func TestLoadConfMissingInclude(t *testing.T) {
+	dir := writeConfFiles(t, map[string]string{
+		".tf.hcl": `include = ["missing.hcl"]`,
+	})
+
+	conf := HclConf{}
+	assert.Error(t, LoadHclConf(filepath.Join(dir, ".tf.hcl"), &conf))
+}
+
+func TestLoadHcl2Conf(t *testing.T) {
+	dir := writeConfFiles(t, map[string]string{
+		"global.hcl": `
+variable "base_memory" {
+  default = 256
+}
+
+global {
+  base_image   = "app"
+  project_name = lower("TEST")
+}
+
+include = ["services/*.hcl"]
+`,
+		"services/web.hcl": `
+service "web" {
+  ecs     = "web"
+  memory  = var.base_memory * 2
+  command = "serve --port ${80 + 8000}"
+  env = {
+    MODE = "web"
+  }
+  links = ["db"]
+}
+`,
+	})
+
+	conf := HclConf{}
+	assert.Nil(t, LoadHcl2Conf(dir, &conf))
+	assert.Equal(t, "test", conf.Global.ProjectName)
+	web := conf.Services["web"]
+	assert.Equal(t, "web", web.Name)
+	assert.Equal(t, 512, web.Memory)
+	assert.Equal(t, "serve --port 8080", web.Command)
+	assert.Equal(t, map[string]string{"MODE": "web"}, web.Env)
+	assert.Equal(t, []string{"db"}, web.Links)
+}
+
+func TestLoadHclConfDetectsHcl2(t *testing.T) {
+	dir := writeConfFiles(t, map[string]string{
+		".tf.hcl": `
+variable "memory" {
+  default = 128
+}
+
+service "web" {
+  ecs    = "web"
+  memory = var.memory * 2
+}
+`,
+		"conf/.tf.hcl2": `service "web" { memory = 64 }`,
+	})
+
+	conf := HclConf{}
+	assert.Nil(t, LoadHclConf(filepath.Join(dir, ".tf.hcl"), &conf))
+	assert.Equal(t, 256, conf.Services["web"].Memory)
+
+	hcl2, err := isHcl2File(filepath.Join(dir, "conf", ".tf.hcl2"))
+	assert.Nil(t, err)
+	assert.True(t, hcl2)
+
+	conf = HclConf{}
+	assert.Nil(t, LoadHclConf(filepath.Join(dir, "conf"), &conf))
+	assert.Equal(t, 64, conf.Services["web"].Memory)
+}
+
+func TestLoadHcl2ConfUnknownVariable(t *testing.T) {
+	dir := writeConfFiles(t, map[string]string{
+		".tf.hcl": `service "web" { memory = var.missing }`,
+	})
+
+	conf := HclConf{}
+	assert.Error(t, LoadHcl2Conf(filepath.Join(dir, ".tf.hcl"), &conf))
+}
+
+func TestTargetDefs(t *testing.T) {
+	dir := writeConfFiles(t, map[string]string{
+		"infra/network/main.tf": ``,
+		"app/main.tf":           ``,
+	})
+
+	conf := HclConf{
+		Global: hclConfGlobal{BaseImage: "app", ProjectName: "test"},
+		Env:    map[string]hclConfVariable{},
+		TargetDefs: map[string]hclConfTarget{
+			"network": {Path: filepath.Join(dir, "infra", "network")},
+			"app":     {Path: filepath.Join(dir, "app"), DependsOn: []string{"network"}},
+		},
+	}
+	assert.Nil(t, conf.finish())
+	assert.Equal(t, []string{"app", "network"}, conf.Targets)
+	assert.Equal(t, "network", conf.TargetDefs["network"].Name)
+	assert.Nil(t, conf.Validate())
+
+	conf.TargetDefs["app"] = hclConfTarget{Name: "app", Path: filepath.Join(dir, "app"), DependsOn: []string{"db"}}
+	assert.Error(t, conf.Validate())
+
+	conf.TargetDefs["app"] = hclConfTarget{Name: "app", Path: filepath.Join(dir, "infra")}
+	assert.Error(t, conf.Validate())
+}
+
+const hcl2CompatibleConf = `
+global {
+  base_image   = "app"
+  project_name = "test"
+  secrets      = "ssm"
+  network {
+    dns = ["10.0.0.2"]
+  }
+}
+
+protected_envs = ["production"]
+
+env "db_password" {
+  sensitive = true
+}
+
+env "replicas" {
+  type     = "int"
+  optional = true
+}
+
+target "network" {
+  path = "infra/network"
+}
+
+target "app" {
+  depends_on = ["network"]
+}
+
+backend "s3" {
+  bucket = "states"
+}
+
+policy "no_deletes" {
+  deny    = "delete"
+  message = "nothing is deleted"
+}
+
+volume "media" {
+  efs {
+    file_system_id = "fs-1234"
+  }
+}
+
+logging "default" {
+  driver         = "awslogs"
+  retention_days = 7
+}
+
+ecs_task "web" {
+  cpu                   = 512
+  memory                = 1024
+  placement_constraints = [{type = "memberOf", expression = "attribute:tier == web"}]
+}
+
+service "web" {
+  image   = "web"
+  ecs     = "web"
+  memory  = 256
+  command = ["serve", "--port", "8080"]
+  ports   = ["80:8080"]
+  env = {
+    MODE = "web"
+  }
+  port "admin" {
+    container = 9000
+  }
+  mount "media" {
+    path      = "/media"
+    read_only = true
+  }
+  ulimit "nofile" {
+    soft = 1024
+    hard = 4096
+  }
+  healthcheck {
+    command = ["curl", "localhost"]
+    retries = 3
+  }
+  logging {
+    stream_prefix = "web"
+  }
+  network {
+    hostname = "web"
+  }
+  depends_on {
+    service   = "db"
+    condition = "HEALTHY"
+  }
+}
+
+service "db" {
+  image   = "postgres"
+  compose = true
+}
+`
+
+func TestLoadHcl2ConfMatchesHcl(t *testing.T) {
+	dir := writeConfFiles(t, map[string]string{".tf.hcl": hcl2CompatibleConf})
+
+	hcl1Conf := HclConf{}
+	assert.Nil(t, LoadHclConf(filepath.Join(dir, ".tf.hcl"), &hcl1Conf))
+	hcl2Conf := HclConf{}
+	assert.Nil(t, LoadHcl2Conf(filepath.Join(dir, ".tf.hcl"), &hcl2Conf))
+	assert.Equal(t, hcl1Conf, hcl2Conf)
+}
+
+func TestLoadHcl2ConfTypeError(t *testing.T) {
+	dir := writeConfFiles(t, map[string]string{
+		".tf.hcl": `
+service "web" {
+  ecs    = "web"
+  memory = "lots"
+}
+`,
+	})
+
+	conf := HclConf{}
+	err := LoadHcl2Conf(filepath.Join(dir, ".tf.hcl"), &conf)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), filepath.Join(dir, ".tf.hcl"))
+	assert.Contains(t, err.Error(), `"lots"`)
+
+	dir2 := writeConfFiles(t, map[string]string{
+		".tf.hcl": "service \"web\" {}\nservice \"web\" {}\n",
+	})
+
+	err = LoadHcl2Conf(filepath.Join(dir2, ".tf.hcl"), &conf)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), ".tf.hcl:2,1-14: service.web is defined twice")
+}
@@ -0,0 +1,92 @@
+package libtf
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+type hclConfHealthcheck struct {
+	Command     []string `hcl:"command"`
+	Interval    string   `hcl:"interval"`
+	Timeout     string   `hcl:"timeout"`
+	Retries     int      `hcl:"retries"`
+	StartPeriod string   `hcl:"start_period"`
+}
+
+type ecsHealthCheck struct {
+	Command     []string `json:"command"`
+	Interval    int      `json:"interval,omitempty"`
+	Timeout     int      `json:"timeout,omitempty"`
+	Retries     int      `json:"retries,omitempty"`
+	StartPeriod int      `json:"startPeriod,omitempty"`
+}
+
+type composeHealthcheck struct {
+	Test        []string `yaml:"test"`
+	Interval    string   `yaml:"interval,omitempty"`
+	Timeout     string   `yaml:"timeout,omitempty"`
+	Retries     int      `yaml:"retries,omitempty"`
+	StartPeriod string   `yaml:"start_period,omitempty"`
+}
+
+func (healthcheck *hclConfHealthcheck) validate() error {
+	if len(healthcheck.Command) == 0 {
+		return errors.New("command is not defined")
+	}
+	for name, value := range map[string]string{
+		"interval":     healthcheck.Interval,
+		"timeout":      healthcheck.Timeout,
+		"start_period": healthcheck.StartPeriod,
+	} {
+		if len(value) == 0 {
+			continue
+		}
+		if _, err := time.ParseDuration(value); err != nil {
+			return fmt.Errorf("%s is invalid: %s", name, err)
+		}
+	}
+	return nil
+}
+
+func (healthcheck *hclConfHealthcheck) test() []string {
+	switch healthcheck.Command[0] {
+	case "CMD", "CMD-SHELL", "NONE":
+		return healthcheck.Command
+	}
+	return append([]string{"CMD"}, healthcheck.Command...)
+}
+
+func durationSeconds(value string) int {
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0
+	}
+	return int(duration / time.Second)
+}
+
+func (healthcheck *hclConfHealthcheck) asEcs() *ecsHealthCheck {
+	if healthcheck == nil {
+		return nil
+	}
+	return &ecsHealthCheck{
+		Command:     healthcheck.test(),
+		Interval:    durationSeconds(healthcheck.Interval),
+		Timeout:     durationSeconds(healthcheck.Timeout),
+		Retries:     healthcheck.Retries,
+		StartPeriod: durationSeconds(healthcheck.StartPeriod),
+	}
+}
+
+func (healthcheck *hclConfHealthcheck) asCompose() *composeHealthcheck {
+	if healthcheck == nil {
+		return nil
+	}
+	return &composeHealthcheck{
+		Test:        healthcheck.test(),
+		Interval:    healthcheck.Interval,
+		Timeout:     healthcheck.Timeout,
+		Retries:     healthcheck.Retries,
+		StartPeriod: healthcheck.StartPeriod,
+	}
+}
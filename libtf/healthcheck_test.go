@@ -0,0 +1,47 @@
+package libtf
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthcheck(t *testing.T) {
+	conf, _ := loadTestConf(t, `
+service "web" {
+  ecs    = "web"
+  memory = 256
+  healthcheck {
+    command      = ["curl", "-f", "http://localhost/"]
+    interval     = "30s"
+    retries      = 3
+    start_period = "1m"
+  }
+}
+`)
+	healthcheck := conf.Services["web"].Healthcheck
+	assert.Nil(t, healthcheck.validate())
+
+	assert.Equal(t, &ecsHealthCheck{
+		Command:     []string{"CMD", "curl", "-f", "http://localhost/"},
+		Interval:    30,
+		Retries:     3,
+		StartPeriod: 60,
+	}, healthcheck.asEcs())
+	assert.Equal(t, &composeHealthcheck{
+		Test:        []string{"CMD", "curl", "-f", "http://localhost/"},
+		Interval:    "30s",
+		Retries:     3,
+		StartPeriod: "1m",
+	}, healthcheck.asCompose())
+
+	shell := hclConfHealthcheck{Command: []string{"CMD-SHELL", "pg_isready"}}
+	assert.Equal(t, []string{"CMD-SHELL", "pg_isready"}, shell.asEcs().Command)
+
+	var missing *hclConfHealthcheck
+	assert.Nil(t, missing.asEcs())
+	assert.Nil(t, missing.asCompose())
+
+	assert.Error(t, (&hclConfHealthcheck{}).validate())
+	assert.Error(t, (&hclConfHealthcheck{Command: []string{"true"}, Interval: "30"}).validate())
+}
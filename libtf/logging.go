@@ -0,0 +1,173 @@
+package libtf
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type hclConfLogging struct {
+	Driver           string            `hcl:"driver"`
+	Options          map[string]string `hcl:"options"`
+	StreamPrefix     string            `hcl:"stream_prefix"`
+	RetentionDays    int               `hcl:"retention_days"`
+	MultilinePattern string            `hcl:"multiline_pattern"`
+	ComposeDriver    string            `hcl:"compose_driver"`
+	ComposeOptions   map[string]string `hcl:"compose_options"`
+}
+
+type ecsLogGroup struct {
+	Name            string `json:"name"`
+	RetentionInDays int    `json:"retention_in_days"`
+}
+
+type byEcsLogGroupName []ecsLogGroup
+
+func (a byEcsLogGroupName) Len() int {
+	return len(a)
+}
+
+func (a byEcsLogGroupName) Swap(i, j int) {
+	a[i], a[j] = a[j], a[i]
+}
+
+func (a byEcsLogGroupName) Less(i, j int) bool {
+	return strings.Compare(a[i].Name, a[j].Name) == -1
+}
+
+type composeLogging struct {
+	Driver  string            `yaml:"driver"`
+	Options map[string]string `yaml:"options,omitempty"`
+}
+
+func mergeOptions(driver string, base map[string]string, overrideDriver string, override map[string]string) map[string]string {
+	res := map[string]string{}
+	if len(overrideDriver) == 0 || overrideDriver == driver {
+		for key, value := range base {
+			res[key] = value
+		}
+	}
+	for key, value := range override {
+		res[key] = value
+	}
+	return res
+}
+
+func (logging hclConfLogging) override(other *hclConfLogging) hclConfLogging {
+	if other == nil {
+		return logging
+	}
+	res := logging
+	res.Options = mergeOptions(logging.Driver, logging.Options, other.Driver, other.Options)
+	res.ComposeOptions = mergeOptions(logging.ComposeDriver, logging.ComposeOptions, other.ComposeDriver, other.ComposeOptions)
+	if len(other.Driver) != 0 {
+		res.Driver = other.Driver
+	}
+	if len(other.ComposeDriver) != 0 {
+		res.ComposeDriver = other.ComposeDriver
+	}
+	if len(other.StreamPrefix) != 0 {
+		res.StreamPrefix = other.StreamPrefix
+	}
+	if other.RetentionDays != 0 {
+		res.RetentionDays = other.RetentionDays
+	}
+	if len(other.MultilinePattern) != 0 {
+		res.MultilinePattern = other.MultilinePattern
+	}
+	return res
+}
+
+func (conf *HclConf) serviceLogging(service *hclConfService, envName string) hclConfLogging {
+	logging := hclConfLogging{}
+	for _, name := range []string{"default", envName} {
+		if envLogging, found := conf.Logging[name]; found {
+			logging = logging.override(&envLogging)
+		}
+	}
+	logging = logging.override(service.Logging)
+	if len(logging.Driver) == 0 {
+		logging.Driver = "awslogs"
+	}
+	return logging
+}
+
+func ecsLogGroupName(vault Vault, service *hclConfService) string {
+	return fmt.Sprintf("%s-%s", vault.EnvName(), service.Name)
+}
+
+func (service *hclConfService) ecsLogConfiguration(conf *HclConf, vault Vault) *ecsLogConfiguration {
+	if service.NoLog {
+		return nil
+	}
+	logging := conf.serviceLogging(service, vault.EnvName())
+	options := map[string]string{}
+	if logging.Driver == "awslogs" {
+		options["awslogs-group"] = ecsLogGroupName(vault, service)
+		options["awslogs-region"] = vault.AwsRegion()
+		if len(logging.StreamPrefix) != 0 {
+			options["awslogs-stream-prefix"] = logging.StreamPrefix
+		}
+		if len(logging.MultilinePattern) != 0 {
+			options["awslogs-multiline-pattern"] = logging.MultilinePattern
+		}
+	}
+	for key, value := range logging.Options {
+		options[key] = value
+	}
+	return &ecsLogConfiguration{
+		LogDriver: logging.Driver,
+		Options:   options,
+	}
+}
+
+func (conf *HclConf) EcsLogGroups(vault Vault, group string) []ecsLogGroup {
+	res := []ecsLogGroup{}
+	for _, service := range conf.Services {
+		if service.Ecs != group || service.NoLog {
+			continue
+		}
+		config := service.ecsLogConfiguration(conf, vault)
+		logging := conf.serviceLogging(&service, vault.EnvName())
+		if config.LogDriver != "awslogs" || logging.RetentionDays == 0 {
+			continue
+		}
+		res = append(res, ecsLogGroup{
+			Name:            config.Options["awslogs-group"],
+			RetentionInDays: logging.RetentionDays,
+		})
+	}
+	sort.Sort(byEcsLogGroupName(res))
+	return res
+}
+
+func (conf *HclConf) usesLogRetention() bool {
+	for _, logging := range conf.Logging {
+		if logging.RetentionDays != 0 {
+			return true
+		}
+	}
+	for _, service := range conf.Services {
+		if service.Logging != nil && service.Logging.RetentionDays != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (service *hclConfService) composeLogging(conf *HclConf, envName string) *composeLogging {
+	if service.NoLog {
+		return &composeLogging{Driver: "none"}
+	}
+	logging := conf.serviceLogging(service, envName)
+	if len(logging.ComposeDriver) == 0 && len(logging.ComposeOptions) == 0 {
+		return nil
+	}
+	if len(logging.ComposeDriver) == 0 {
+		logging.ComposeDriver = "json-file"
+	}
+	return &composeLogging{
+		Driver:  logging.ComposeDriver,
+		Options: logging.ComposeOptions,
+	}
+}
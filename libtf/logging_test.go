@@ -0,0 +1,77 @@
+package libtf
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogging(t *testing.T) {
+	conf, _ := loadTestConf(t, `
+logging "default" {
+  stream_prefix  = "app"
+  retention_days = 14
+}
+
+logging "prod" {
+  driver = "fluentd"
+  options = {
+    fluentd-address = "fluentd:24224"
+  }
+}
+
+service "web" {
+  image   = "web"
+  ecs     = "web"
+  compose = true
+  memory  = 128
+  logging {
+    multiline_pattern = "^\\["
+    compose_options = {
+      max-size = "10m"
+    }
+  }
+}
+
+service "worker" {
+  image   = "worker"
+  ecs     = "web"
+  compose = true
+  memory  = 128
+  nolog   = true
+}
+`)
+
+	staging := testVault("staging")
+	prod := testVault("prod")
+	web := conf.Services["web"]
+	worker := conf.Services["worker"]
+
+	assert.Equal(t, &ecsLogConfiguration{
+		LogDriver: "awslogs",
+		Options: map[string]string{
+			"awslogs-group":             "staging-web",
+			"awslogs-region":            "us-east-1",
+			"awslogs-stream-prefix":     "app",
+			"awslogs-multiline-pattern": "^\\[",
+		},
+	}, web.ecsLogConfiguration(&conf, staging))
+	assert.Equal(t, &ecsLogConfiguration{
+		LogDriver: "fluentd",
+		Options:   map[string]string{"fluentd-address": "fluentd:24224"},
+	}, web.ecsLogConfiguration(&conf, prod))
+	assert.Nil(t, worker.ecsLogConfiguration(&conf, staging))
+
+	assert.Equal(t, []ecsLogGroup{{Name: "staging-web", RetentionInDays: 14}}, conf.EcsLogGroups(staging, "web"))
+	assert.Equal(t, []ecsLogGroup{}, conf.EcsLogGroups(prod, "web"))
+	assert.True(t, conf.usesLogRetention())
+
+	assert.Equal(t, &composeLogging{
+		Driver:  "json-file",
+		Options: map[string]string{"max-size": "10m"},
+	}, web.composeLogging(&conf, "staging"))
+	assert.Equal(t, &composeLogging{Driver: "none"}, worker.composeLogging(&conf, "staging"))
+	delete(conf.Logging, "default")
+	web.Logging = nil
+	assert.Nil(t, web.composeLogging(&conf, "staging"))
+}
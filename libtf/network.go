@@ -0,0 +1,173 @@
+package libtf
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type hclConfNetwork struct {
+	Mode          string            `hcl:"mode"`
+	Dns           []string          `hcl:"dns"`
+	SearchDomains []string          `hcl:"search_domains"`
+	ExtraHosts    map[string]string `hcl:"extra_hosts"`
+	Hostname      string            `hcl:"hostname"`
+	Namespace     string            `hcl:"namespace"`
+}
+
+type ecsHostEntry struct {
+	Hostname  string `json:"hostname"`
+	IPAddress string `json:"ipAddress"`
+}
+
+type byEcsHostname []ecsHostEntry
+
+func (a byEcsHostname) Len() int {
+	return len(a)
+}
+
+func (a byEcsHostname) Swap(i, j int) {
+	a[i], a[j] = a[j], a[i]
+}
+
+func (a byEcsHostname) Less(i, j int) bool {
+	return strings.Compare(a[i].Hostname, a[j].Hostname) == -1
+}
+
+func (network hclConfNetwork) isSet() bool {
+	return len(network.Mode) != 0 || network.Dns != nil || network.SearchDomains != nil ||
+		len(network.ExtraHosts) != 0 || len(network.Hostname) != 0 || len(network.Namespace) != 0
+}
+
+func (network hclConfNetwork) override(other *hclConfNetwork) hclConfNetwork {
+	if other == nil {
+		return network
+	}
+	res := network
+	if len(other.Mode) != 0 {
+		res.Mode = other.Mode
+	}
+	if other.Dns != nil {
+		res.Dns = other.Dns
+	}
+	if other.SearchDomains != nil {
+		res.SearchDomains = other.SearchDomains
+	}
+	res.ExtraHosts = map[string]string{}
+	for host, ip := range network.ExtraHosts {
+		res.ExtraHosts[host] = ip
+	}
+	for host, ip := range other.ExtraHosts {
+		res.ExtraHosts[host] = ip
+	}
+	if len(other.Hostname) != 0 {
+		res.Hostname = other.Hostname
+	}
+	if len(other.Namespace) != 0 {
+		res.Namespace = other.Namespace
+	}
+	return res
+}
+
+func (conf *HclConf) serviceNetwork(service *hclConfService) hclConfNetwork {
+	global := conf.Global.Network
+	global.Hostname = ""
+	network := global.override(service.Network)
+	if len(network.Mode) == 0 {
+		network.Mode = "bridge"
+	}
+	if len(network.Namespace) == 0 {
+		network.Namespace = "internal"
+	}
+	return network
+}
+
+func (network hclConfNetwork) ecsSearchDomains() []string {
+	if network.Mode == "awsvpc" {
+		return nil
+	}
+	if network.SearchDomains == nil {
+		return []string{"internal"}
+	}
+	return network.SearchDomains
+}
+
+func (network hclConfNetwork) ecsExtraHosts() []ecsHostEntry {
+	res := []ecsHostEntry{}
+	for host, ip := range network.ExtraHosts {
+		res = append(res, ecsHostEntry{
+			Hostname:  host,
+			IPAddress: ip,
+		})
+	}
+	sort.Sort(byEcsHostname(res))
+	return res
+}
+
+func (network hclConfNetwork) composeExtraHosts() []string {
+	res := []string{}
+	for _, entry := range network.ecsExtraHosts() {
+		res = append(res, fmt.Sprintf("%s:%s", entry.Hostname, entry.IPAddress))
+	}
+	return res
+}
+
+func (network hclConfNetwork) composeMode() string {
+	if network.Mode == "host" {
+		return "host"
+	}
+	return ""
+}
+
+func DiscoveryVar(service string) string {
+	return fmt.Sprintf("%s_HOST", strings.ToUpper(strings.Replace(service, "-", "_", -1)))
+}
+
+func (conf *HclConf) discoveryEnv(service *hclConfService, network hclConfNetwork, compose bool) map[string]string {
+	res := map[string]string{}
+	if network.Mode != "awsvpc" {
+		return res
+	}
+	for _, name := range service.Links {
+		if compose {
+			res[DiscoveryVar(name)] = name
+		} else if conf.EcsServices[name] {
+			res[DiscoveryVar(name)] = fmt.Sprintf("%s.%s", name, network.Namespace)
+		}
+	}
+	return res
+}
+
+func (conf *HclConf) validateNetwork() error {
+	if len(conf.Global.Network.Hostname) != 0 {
+		return fmt.Errorf("global.network.hostname is only supported on services")
+	}
+	modes := map[string]string{}
+	for _, name := range conf.serviceNames() {
+		service := conf.Services[name]
+		network := conf.serviceNetwork(&service)
+		switch network.Mode {
+		case "bridge", "host", "awsvpc":
+		default:
+			return fmt.Errorf("services.%s network mode %s is not one of bridge, host, awsvpc", name, network.Mode)
+		}
+		for host, ip := range network.ExtraHosts {
+			if len(host) == 0 || len(ip) == 0 {
+				return fmt.Errorf("services.%s.network.extra_hosts has empty entry", name)
+			}
+		}
+		if len(service.Ecs) == 0 {
+			continue
+		}
+		if other, found := modes[service.Ecs]; found && other != network.Mode {
+			return fmt.Errorf("services in ecs %s use both %s and %s network modes", service.Ecs, other, network.Mode)
+		}
+		modes[service.Ecs] = network.Mode
+		if network.Mode == "awsvpc" {
+			if len(network.Dns) != 0 || len(network.SearchDomains) != 0 || len(network.ExtraHosts) != 0 || len(network.Hostname) != 0 {
+				return fmt.Errorf("services.%s dns, search_domains, extra_hosts and hostname are not supported in awsvpc network mode", name)
+			}
+		}
+	}
+	return nil
+}
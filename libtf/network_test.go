@@ -0,0 +1,81 @@
+package libtf
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNetwork(t *testing.T) {
+	conf, _ := loadTestConf(t, `
+global {
+  network {
+    dns            = ["10.0.0.2"]
+    search_domains = ["corp"]
+    extra_hosts = {
+      registry = "10.0.0.5"
+    }
+  }
+}
+
+service "web" {
+  image   = "web"
+  ecs     = "web"
+  compose = true
+  memory  = 128
+  links   = ["api"]
+  network {
+    hostname = "web"
+    extra_hosts = {
+      metrics = "10.0.0.6"
+    }
+  }
+}
+
+service "api" {
+  image  = "api"
+  ecs    = "api"
+  memory = 128
+}
+`)
+	assert.Nil(t, conf.validateNetwork())
+
+	vault := testVault("test")
+	web := conf.Services["web"]
+	ecs := web.asEcs(&conf, vault, nil)
+	assert.Equal(t, []string{"corp"}, ecs.DNSSearchDomains)
+	assert.Equal(t, []string{"10.0.0.2"}, ecs.DNSServers)
+	assert.Equal(t, "web", ecs.Hostname)
+	assert.Equal(t, []ecsHostEntry{
+		{Hostname: "metrics", IPAddress: "10.0.0.6"},
+		{Hostname: "registry", IPAddress: "10.0.0.5"},
+	}, ecs.ExtraHosts)
+	assert.Equal(t, []string{"api"}, ecs.Links)
+
+	compose := web.asCompose(&conf, vault)
+	assert.Equal(t, []string{"corp"}, compose.DNSSearch)
+	assert.Equal(t, []string{"metrics:10.0.0.6", "registry:10.0.0.5"}, compose.ExtraHosts)
+	assert.Equal(t, "web", compose.Hostname)
+
+	api := conf.Services["api"]
+	assert.Equal(t, []string{"corp"}, api.asEcs(&conf, vault, nil).DNSSearchDomains)
+	assert.Empty(t, api.asEcs(&conf, vault, nil).Hostname)
+	assert.Equal(t, []string{"internal"}, (&HclConf{}).serviceNetwork(&api).ecsSearchDomains())
+
+	conf.Global.Network = hclConfNetwork{Mode: "awsvpc", Namespace: "svc.local"}
+	assert.Error(t, conf.validateNetwork())
+	web.Network = nil
+	conf.Services["web"] = web
+	assert.Nil(t, conf.validateNetwork())
+
+	ecs = web.asEcs(&conf, vault, nil)
+	assert.Empty(t, ecs.Links)
+	assert.Nil(t, ecs.DNSSearchDomains)
+	assert.Equal(t, []ecsEnvVariable{{Name: "API_HOST", Value: "api.svc.local"}}, ecs.Environment)
+	assert.Equal(t, "api", web.asCompose(&conf, vault).Environment["API_HOST"])
+
+	api.Network = &hclConfNetwork{Mode: "bridge"}
+	api.Ecs = "web"
+	conf.Services["api"] = api
+	assert.Error(t, conf.validateNetwork())
+}
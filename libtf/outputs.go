@@ -0,0 +1,111 @@
+package libtf
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"os/exec"
+
+	"github.com/fatih/color"
+)
+
+type terraformOutput struct {
+	Value interface{} `json:"value"`
+}
+
+func TargetOutputVar(target string, output string) string {
+	return target + "_" + output
+}
+
+func jsonToVaultValue(value interface{}) interface{} {
+	switch value.(type) {
+	case json.Number:
+		number := value.(json.Number)
+		if intValue, err := number.Int64(); err == nil {
+			return int(intValue)
+		}
+		return number.String()
+	case []interface{}:
+		res := []interface{}{}
+		for _, item := range value.([]interface{}) {
+			res = append(res, jsonToVaultValue(item))
+		}
+		return res
+	case map[string]interface{}:
+		res := map[string]interface{}{}
+		for key, item := range value.(map[string]interface{}) {
+			res[key] = jsonToVaultValue(item)
+		}
+		return res
+	default:
+		return value
+	}
+}
+
+func ReadTerraformOutputs(dir string, env []string) (map[string]interface{}, error) {
+	bin, err := exec.LookPath("terraform")
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(bin, "output", "-json")
+	cmd.Dir = dir
+	cmd.Env = env
+	cmd.Stderr = os.Stderr
+	data, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+
+	outputs := map[string]terraformOutput{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&outputs); err != nil {
+		return nil, err
+	}
+
+	res := map[string]interface{}{}
+	for name, output := range outputs {
+		res[name] = jsonToVaultValue(output.Value)
+	}
+	return res, nil
+}
+
+func (conf *HclConf) terraformValueToString(value interface{}) (string, error) {
+	if conf.Global.TypedVars {
+		return terraformValueToString(value)
+	}
+	return envValueToString(value)
+}
+
+func (conf *HclConf) DependencyOutputs(vault Vault, target string) (map[string]string, error) {
+	res := map[string]string{}
+	for _, dependency := range conf.TargetDefs[target].DependsOn {
+		dir := conf.TargetDefs[dependency].Path
+		if err := conf.EnsureRemoteState(vault, dir, dependency); err != nil {
+			return nil, err
+		}
+		env, err := conf.TerraformEnv(vault, nil)
+		if err != nil {
+			return nil, err
+		}
+		outputs, err := ReadTerraformOutputs(dir, WithProcessEnv(env))
+		if err != nil {
+			return nil, err
+		}
+		for name, value := range outputs {
+			key := TargetOutputVar(dependency, name)
+			if _, found := vault.Raw[EnvKey(key)]; found {
+				color.Yellow("output %s.%s is shadowed by vault key %s", dependency, name, key)
+				continue
+			}
+			str, err := conf.terraformValueToString(value)
+			if err != nil {
+				color.Yellow("output %s.%s is skipped: %s", dependency, name, err)
+				continue
+			}
+			res[EnvKey(key)] = str
+		}
+	}
+	return res, nil
+}
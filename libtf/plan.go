@@ -0,0 +1,148 @@
+package libtf
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"sort"
+)
+
+const planDir = ".tf-plan"
+
+type PlanManifest struct {
+	GitVersion       string            `json:"git_version"`
+	VaultFingerprint string            `json:"vault_fingerprint"`
+	EcsDefs          map[string]string `json:"ecs_defs"`
+	TerraformVersion string            `json:"terraform_version"`
+}
+
+func PlanFile(envName string) string {
+	return filepath.Join(planDir, fmt.Sprintf("%s.tfplan", envName))
+}
+
+func PlanManifestFile(envName string) string {
+	return filepath.Join(planDir, fmt.Sprintf("%s.json", envName))
+}
+
+func (vault *Vault) Fingerprint(keyString string) string {
+	raw := vault.WithoutDefaults().Raw
+	keys := []string{}
+	for key := range raw {
+		keys = append(keys, key)
+	}
+	sort.Sort(ByString(keys))
+	mac := hmac.New(sha256.New, []byte(keyString))
+	for _, key := range keys {
+		fmt.Fprintf(mac, "%s=%s\n", key, raw[key])
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (conf *HclConf) ecsDefHashes(vault Vault) (map[string]string, error) {
+	_, files, err := conf.renderEcsDefs(vault)
+	if err != nil {
+		return nil, err
+	}
+	res := map[string]string{}
+	for filename, data := range files {
+		sum := sha256.Sum256(data)
+		res[filepath.Base(filename)] = hex.EncodeToString(sum[:])
+	}
+	return res, nil
+}
+
+func TerraformVersion() (string, error) {
+	bin, err := exec.LookPath("terraform")
+	if err != nil {
+		return "", err
+	}
+	data, err := exec.Command(bin, "version").Output()
+	if err != nil {
+		return "", err
+	}
+	line, _, err := bufio.NewReader(bytes.NewReader(data)).ReadLine()
+	if err != nil {
+		return "", err
+	}
+	return string(line), nil
+}
+
+func (conf *HclConf) NewPlanManifest(vault Vault) (*PlanManifest, error) {
+	ecsDefs, err := conf.ecsDefHashes(vault)
+	if err != nil {
+		return nil, err
+	}
+	terraformVersion, err := TerraformVersion()
+	if err != nil {
+		return nil, err
+	}
+	return &PlanManifest{
+		GitVersion:       GetGitVersion(),
+		VaultFingerprint: vault.Fingerprint(conf.Keys[conf.Global.ProjectName]),
+		EcsDefs:          ecsDefs,
+		TerraformVersion: terraformVersion,
+	}, nil
+}
+
+func LoadPlanManifest(filename string) (*PlanManifest, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	manifest := PlanManifest{}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+func (manifest *PlanManifest) Save(filename string) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, data, 0600)
+}
+
+func (manifest *PlanManifest) Diff(current *PlanManifest) []string {
+	res := []string{}
+	if manifest.GitVersion != current.GitVersion {
+		res = append(res, fmt.Sprintf("git version changed from %s to %s", manifest.GitVersion, current.GitVersion))
+	}
+	if manifest.VaultFingerprint != current.VaultFingerprint {
+		res = append(res, "vault values changed")
+	}
+	if manifest.TerraformVersion != current.TerraformVersion {
+		res = append(res, fmt.Sprintf("terraform version changed from %s to %s", manifest.TerraformVersion, current.TerraformVersion))
+	}
+	names := []string{}
+	for name := range manifest.EcsDefs {
+		names = append(names, name)
+	}
+	for name := range current.EcsDefs {
+		if _, found := manifest.EcsDefs[name]; !found {
+			names = append(names, name)
+		}
+	}
+	sort.Sort(ByString(names))
+	for _, name := range names {
+		before, planned := manifest.EcsDefs[name]
+		after, exists := current.EcsDefs[name]
+		switch {
+		case !exists:
+			res = append(res, fmt.Sprintf(".ecs-def/%s was removed", name))
+		case !planned:
+			res = append(res, fmt.Sprintf(".ecs-def/%s was added", name))
+		case before != after:
+			res = append(res, fmt.Sprintf(".ecs-def/%s changed", name))
+		}
+	}
+	return res
+}
@@ -0,0 +1,95 @@
+package libtf
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/src-d/go-git.v4"
+)
+
+func TestPlanManifestDiff(t *testing.T) {
+	planned := &PlanManifest{
+		GitVersion:       "abc",
+		VaultFingerprint: "1",
+		TerraformVersion: "Terraform v1.5.7",
+		EcsDefs: map[string]string{
+			"web.json":    "1",
+			"worker.json": "2",
+		},
+	}
+	assert.Empty(t, planned.Diff(planned))
+
+	current := &PlanManifest{
+		GitVersion:       "def",
+		VaultFingerprint: "2",
+		TerraformVersion: "Terraform v1.5.7",
+		EcsDefs: map[string]string{
+			"web.json":  "3",
+			"cron.json": "4",
+		},
+	}
+	assert.Equal(t, []string{
+		"git version changed from abc to def",
+		"vault values changed",
+		".ecs-def/cron.json was added",
+		".ecs-def/web.json changed",
+		".ecs-def/worker.json was removed",
+	}, planned.Diff(current))
+}
+
+func TestVaultFingerprint(t *testing.T) {
+	vault1 := Vault{Raw: map[string]string{"TF_VAR_a": "1", "git_version": "abc"}}
+	vault2 := Vault{Raw: map[string]string{"TF_VAR_a": "1", "git_version": "def"}}
+	vault3 := Vault{Raw: map[string]string{"TF_VAR_a": "2"}}
+	assert.Equal(t, vault1.Fingerprint("key"), vault2.Fingerprint("key"))
+	assert.NotEqual(t, vault1.Fingerprint("key"), vault3.Fingerprint("key"))
+	assert.NotEqual(t, vault1.Fingerprint("key"), vault1.Fingerprint("other"))
+
+	plain := sha256.Sum256([]byte("TF_VAR_a=1\n"))
+	assert.NotEqual(t, hex.EncodeToString(plain[:]), vault1.Fingerprint(""))
+}
+
+func TestEcsDefHashesMatchWrittenDefs(t *testing.T) {
+	conf, dir := loadTestConf(t, `
+service "web" {
+  image = "web:latest"
+  ecs   = "app"
+}
+
+service "worker" {
+  image = "worker:latest"
+  ecs   = "app"
+}
+`)
+	vault := testVault("test")
+
+	hashes, err := conf.ecsDefHashes(vault)
+	assert.Nil(t, err)
+	_, err = os.Stat(filepath.Join(dir, ".ecs-def"))
+	assert.True(t, os.IsNotExist(err))
+
+	_, err = conf.WriteEcsDefs(vault, dir)
+	assert.Nil(t, err)
+	data, err := ioutil.ReadFile(filepath.Join(dir, ".ecs-def", "app.json"))
+	assert.Nil(t, err)
+	sum := sha256.Sum256(data)
+	assert.Equal(t, map[string]string{"app.json": hex.EncodeToString(sum[:])}, hashes)
+}
+
+func TestGitStatusIsClean(t *testing.T) {
+	assert.True(t, gitStatusIsClean(git.Status{}))
+	assert.True(t, gitStatusIsClean(git.Status{
+		".tf-plan/staging.json": {Staging: git.Untracked, Worktree: git.Untracked},
+	}))
+	assert.False(t, gitStatusIsClean(git.Status{
+		"app/main.tf": {Staging: git.Unmodified, Worktree: git.Modified},
+	}))
+	assert.False(t, gitStatusIsClean(git.Status{
+		"app/new.tf": {Staging: git.Added, Worktree: git.Unmodified},
+	}))
+}
@@ -0,0 +1,648 @@
+package libtf
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type hclConfPolicy struct {
+	Deny    string `hcl:"deny"`
+	Message string `hcl:"message"`
+}
+
+type policyToken struct {
+	kind  string
+	value string
+	pos   int
+}
+
+var policyOperators = []string{"==", "!=", "<=", ">=", "=~", "&&", "||", "<", ">", "!", "(", ")", "[", "]", ",", "."}
+
+var policyComparisons = map[string]bool{
+	"==": true,
+	"!=": true,
+	"<":  true,
+	"<=": true,
+	">":  true,
+	">=": true,
+	"=~": true,
+	"in": true,
+}
+
+var policyRoots = map[string]bool{
+	"type":    true,
+	"name":    true,
+	"address": true,
+	"mode":    true,
+	"action":  true,
+	"env":     true,
+	"before":  true,
+	"after":   true,
+}
+
+func tokenizePolicy(input string) ([]policyToken, error) {
+	tokens := []policyToken{}
+	pos := 0
+	for pos < len(input) {
+		char := rune(input[pos])
+		switch {
+		case unicode.IsSpace(char):
+			pos++
+		case char == '"' || char == '\'':
+			end := pos + 1
+			value := []byte{}
+			for ; end < len(input) && rune(input[end]) != char; end++ {
+				if input[end] == '\\' && end+1 < len(input) {
+					end++
+				}
+				value = append(value, input[end])
+			}
+			if end >= len(input) {
+				return nil, fmt.Errorf("unterminated string at %d", pos)
+			}
+			tokens = append(tokens, policyToken{"string", string(value), pos})
+			pos = end + 1
+		case unicode.IsDigit(char) || (char == '-' && pos+1 < len(input) && unicode.IsDigit(rune(input[pos+1]))):
+			end := pos + 1
+			for end < len(input) && (unicode.IsDigit(rune(input[end])) || input[end] == '.') {
+				end++
+			}
+			tokens = append(tokens, policyToken{"number", input[pos:end], pos})
+			pos = end
+		case unicode.IsLetter(char) || char == '_':
+			end := pos + 1
+			for end < len(input) && (unicode.IsLetter(rune(input[end])) || unicode.IsDigit(rune(input[end])) || input[end] == '_' || input[end] == '-') {
+				end++
+			}
+			tokens = append(tokens, policyToken{"ident", input[pos:end], pos})
+			pos = end
+		default:
+			found := false
+			for _, operator := range policyOperators {
+				if strings.HasPrefix(input[pos:], operator) {
+					tokens = append(tokens, policyToken{"op", operator, pos})
+					pos += len(operator)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("unexpected %q at %d", char, pos)
+			}
+		}
+	}
+	return append(tokens, policyToken{"eof", "", len(input)}), nil
+}
+
+type policyExpr interface {
+	eval(ctx map[string]interface{}) (interface{}, error)
+}
+
+type policyLiteral struct {
+	value interface{}
+}
+
+type policyList struct {
+	items []policyExpr
+}
+
+type policyPath struct {
+	root string
+	keys []string
+}
+
+type policyUnary struct {
+	operand policyExpr
+}
+
+type policyBinary struct {
+	operator string
+	left     policyExpr
+	right    policyExpr
+}
+
+type policyCall struct {
+	name string
+	args []policyExpr
+}
+
+type policyParser struct {
+	tokens []policyToken
+	pos    int
+}
+
+func (parser *policyParser) peek() policyToken {
+	return parser.tokens[parser.pos]
+}
+
+func (parser *policyParser) next() policyToken {
+	token := parser.tokens[parser.pos]
+	if token.kind != "eof" {
+		parser.pos++
+	}
+	return token
+}
+
+func (parser *policyParser) accept(kind string, value string) bool {
+	token := parser.peek()
+	if token.kind == kind && token.value == value {
+		parser.pos++
+		return true
+	}
+	return false
+}
+
+func (parser *policyParser) expect(kind string, value string) error {
+	if !parser.accept(kind, value) {
+		token := parser.peek()
+		return fmt.Errorf("expected %s at %d, found %q", value, token.pos, token.value)
+	}
+	return nil
+}
+
+func (parser *policyParser) parseOr() (policyExpr, error) {
+	left, err := parser.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for parser.accept("op", "||") {
+		right, err := parser.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = policyBinary{"||", left, right}
+	}
+	return left, nil
+}
+
+func (parser *policyParser) parseAnd() (policyExpr, error) {
+	left, err := parser.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for parser.accept("op", "&&") {
+		right, err := parser.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = policyBinary{"&&", left, right}
+	}
+	return left, nil
+}
+
+func (parser *policyParser) parseNot() (policyExpr, error) {
+	if parser.accept("op", "!") {
+		operand, err := parser.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return policyUnary{operand}, nil
+	}
+	return parser.parseComparison()
+}
+
+func (parser *policyParser) parseComparison() (policyExpr, error) {
+	left, err := parser.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	token := parser.peek()
+	if token.kind != "op" && token.kind != "ident" || !policyComparisons[token.value] {
+		return left, nil
+	}
+	parser.next()
+	right, err := parser.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	if token.value == "=~" {
+		literal, ok := right.(policyLiteral)
+		pattern, isString := literal.value.(string)
+		if !ok || !isString {
+			return nil, fmt.Errorf("=~ at %d expects a string pattern", token.pos)
+		}
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		right = policyLiteral{compiled}
+	}
+	return policyBinary{token.value, left, right}, nil
+}
+
+func (parser *policyParser) parsePrimary() (policyExpr, error) {
+	token := parser.next()
+	switch token.kind {
+	case "string":
+		return policyLiteral{token.value}, nil
+	case "number":
+		number, err := strconv.ParseFloat(token.value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %s at %d", token.value, token.pos)
+		}
+		return policyLiteral{number}, nil
+	case "op":
+		switch token.value {
+		case "(":
+			expr, err := parser.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			return expr, parser.expect("op", ")")
+		case "[":
+			list := policyList{}
+			for !parser.accept("op", "]") {
+				if len(list.items) != 0 {
+					if err := parser.expect("op", ","); err != nil {
+						return nil, err
+					}
+				}
+				item, err := parser.parsePrimary()
+				if err != nil {
+					return nil, err
+				}
+				list.items = append(list.items, item)
+			}
+			return list, nil
+		}
+	case "ident":
+		switch token.value {
+		case "true":
+			return policyLiteral{true}, nil
+		case "false":
+			return policyLiteral{false}, nil
+		case "null":
+			return policyLiteral{nil}, nil
+		}
+		if parser.accept("op", "(") {
+			call := policyCall{name: token.value}
+			for !parser.accept("op", ")") {
+				if len(call.args) != 0 {
+					if err := parser.expect("op", ","); err != nil {
+						return nil, err
+					}
+				}
+				arg, err := parser.parseOr()
+				if err != nil {
+					return nil, err
+				}
+				call.args = append(call.args, arg)
+			}
+			return call, call.check()
+		}
+		if !policyRoots[token.value] {
+			return nil, fmt.Errorf("unknown identifier %s at %d", token.value, token.pos)
+		}
+		path := policyPath{root: token.value}
+		for {
+			if parser.accept("op", ".") {
+				key := parser.next()
+				if key.kind != "ident" && key.kind != "number" {
+					return nil, fmt.Errorf("expected attribute name at %d", key.pos)
+				}
+				path.keys = append(path.keys, key.value)
+			} else if parser.accept("op", "[") {
+				key := parser.next()
+				if key.kind != "string" && key.kind != "number" {
+					return nil, fmt.Errorf("expected index at %d", key.pos)
+				}
+				path.keys = append(path.keys, key.value)
+				if err := parser.expect("op", "]"); err != nil {
+					return nil, err
+				}
+			} else {
+				return path, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("unexpected %q at %d", token.value, token.pos)
+}
+
+func ParsePolicy(input string) (policyExpr, error) {
+	tokens, err := tokenizePolicy(input)
+	if err != nil {
+		return nil, err
+	}
+	parser := policyParser{tokens: tokens}
+	expr, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if token := parser.peek(); token.kind != "eof" {
+		return nil, fmt.Errorf("unexpected %q at %d", token.value, token.pos)
+	}
+	return expr, nil
+}
+
+func policyTruthy(value interface{}) (bool, error) {
+	switch value.(type) {
+	case nil:
+		return false, nil
+	case bool:
+		return value.(bool), nil
+	default:
+		return false, fmt.Errorf("%v is not a bool", value)
+	}
+}
+
+func policyNormalize(value interface{}) interface{} {
+	switch value.(type) {
+	case int:
+		return float64(value.(int))
+	case json.Number:
+		number, err := value.(json.Number).Float64()
+		if err != nil {
+			return value.(json.Number).String()
+		}
+		return number
+	default:
+		return value
+	}
+}
+
+func (expr policyLiteral) eval(ctx map[string]interface{}) (interface{}, error) {
+	return expr.value, nil
+}
+
+func (expr policyList) eval(ctx map[string]interface{}) (interface{}, error) {
+	res := []interface{}{}
+	for _, item := range expr.items {
+		value, err := item.eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, value)
+	}
+	return res, nil
+}
+
+func (expr policyPath) eval(ctx map[string]interface{}) (interface{}, error) {
+	value := ctx[expr.root]
+	for _, key := range expr.keys {
+		switch value.(type) {
+		case map[string]interface{}:
+			value = value.(map[string]interface{})[key]
+		case []interface{}:
+			list := value.([]interface{})
+			idx, err := strconv.Atoi(key)
+			if err != nil || idx < 0 || idx >= len(list) {
+				return nil, nil
+			}
+			value = list[idx]
+		default:
+			return nil, nil
+		}
+	}
+	return policyNormalize(value), nil
+}
+
+func (expr policyUnary) eval(ctx map[string]interface{}) (interface{}, error) {
+	value, err := expr.operand.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	truthy, err := policyTruthy(value)
+	return !truthy, err
+}
+
+func (expr policyBinary) eval(ctx map[string]interface{}) (interface{}, error) {
+	left, err := expr.left.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	switch expr.operator {
+	case "&&", "||":
+		leftTruthy, err := policyTruthy(left)
+		if err != nil {
+			return nil, err
+		}
+		if leftTruthy == (expr.operator == "||") {
+			return leftTruthy, nil
+		}
+		right, err := expr.right.eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return policyTruthy(right)
+	}
+	right, err := expr.right.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	switch expr.operator {
+	case "==":
+		return reflect.DeepEqual(left, right), nil
+	case "!=":
+		return !reflect.DeepEqual(left, right), nil
+	case "=~":
+		text, ok := left.(string)
+		return ok && right.(*regexp.Regexp).MatchString(text), nil
+	case "in":
+		switch right.(type) {
+		case []interface{}:
+			for _, item := range right.([]interface{}) {
+				if reflect.DeepEqual(left, policyNormalize(item)) {
+					return true, nil
+				}
+			}
+			return false, nil
+		case map[string]interface{}:
+			key, ok := left.(string)
+			_, found := right.(map[string]interface{})[key]
+			return ok && found, nil
+		case nil:
+			return false, nil
+		default:
+			return nil, fmt.Errorf("in expects a list or a map, got %v", right)
+		}
+	}
+	if leftNumber, ok := left.(float64); ok {
+		rightNumber, ok := right.(float64)
+		if !ok {
+			return false, nil
+		}
+		switch expr.operator {
+		case "<":
+			return leftNumber < rightNumber, nil
+		case "<=":
+			return leftNumber <= rightNumber, nil
+		case ">":
+			return leftNumber > rightNumber, nil
+		default:
+			return leftNumber >= rightNumber, nil
+		}
+	}
+	if leftString, ok := left.(string); ok {
+		rightString, ok := right.(string)
+		if !ok {
+			return false, nil
+		}
+		switch expr.operator {
+		case "<":
+			return leftString < rightString, nil
+		case "<=":
+			return leftString <= rightString, nil
+		case ">":
+			return leftString > rightString, nil
+		default:
+			return leftString >= rightString, nil
+		}
+	}
+	return false, nil
+}
+
+func (expr policyCall) check() error {
+	arity := map[string]int{
+		"has":        1,
+		"len":        1,
+		"startswith": 2,
+		"endswith":   2,
+	}
+	expected, found := arity[expr.name]
+	if !found {
+		return fmt.Errorf("unknown function %s", expr.name)
+	}
+	if len(expr.args) != expected {
+		return fmt.Errorf("%s expects %d arguments", expr.name, expected)
+	}
+	return nil
+}
+
+func (expr policyCall) eval(ctx map[string]interface{}) (interface{}, error) {
+	args := []interface{}{}
+	for _, arg := range expr.args {
+		value, err := arg.eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, value)
+	}
+	switch expr.name {
+	case "has":
+		return args[0] != nil, nil
+	case "len":
+		switch args[0].(type) {
+		case string:
+			return float64(len(args[0].(string))), nil
+		case []interface{}:
+			return float64(len(args[0].([]interface{}))), nil
+		case map[string]interface{}:
+			return float64(len(args[0].(map[string]interface{}))), nil
+		default:
+			return float64(0), nil
+		}
+	default:
+		text, ok1 := args[0].(string)
+		affix, ok2 := args[1].(string)
+		if !ok1 || !ok2 {
+			return false, nil
+		}
+		if expr.name == "startswith" {
+			return strings.HasPrefix(text, affix), nil
+		}
+		return strings.HasSuffix(text, affix), nil
+	}
+}
+
+type terraformPlan struct {
+	ResourceChanges []struct {
+		Address string `json:"address"`
+		Mode    string `json:"mode"`
+		Type    string `json:"type"`
+		Name    string `json:"name"`
+		Change  struct {
+			Actions []string    `json:"actions"`
+			Before  interface{} `json:"before"`
+			After   interface{} `json:"after"`
+		} `json:"change"`
+	} `json:"resource_changes"`
+}
+
+type PolicyViolation struct {
+	Policy  string
+	Address string
+	Action  string
+	Message string
+}
+
+func (violation PolicyViolation) String() string {
+	return fmt.Sprintf("policy.%s: %s (%s): %s", violation.Policy, violation.Address, violation.Action, violation.Message)
+}
+
+func (conf *HclConf) compilePolicies() (map[string]policyExpr, error) {
+	res := map[string]policyExpr{}
+	for name, policy := range conf.Policies {
+		if len(policy.Deny) == 0 {
+			return nil, fmt.Errorf("policy.%s.deny is not defined", name)
+		}
+		expr, err := ParsePolicy(policy.Deny)
+		if err != nil {
+			return nil, fmt.Errorf("policy.%s.deny: %s", name, err)
+		}
+		res[name] = expr
+	}
+	return res, nil
+}
+
+func (conf *HclConf) CheckPolicies(planJSON []byte, envName string) ([]PolicyViolation, error) {
+	policies, err := conf.compilePolicies()
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for name := range policies {
+		names = append(names, name)
+	}
+	sort.Sort(ByString(names))
+
+	plan := terraformPlan{}
+	decoder := json.NewDecoder(bytes.NewReader(planJSON))
+	decoder.UseNumber()
+	if err := decoder.Decode(&plan); err != nil {
+		return nil, err
+	}
+
+	violations := []PolicyViolation{}
+	for _, change := range plan.ResourceChanges {
+		for _, action := range change.Change.Actions {
+			if action == "no-op" {
+				continue
+			}
+			ctx := map[string]interface{}{
+				"type":    change.Type,
+				"name":    change.Name,
+				"address": change.Address,
+				"mode":    change.Mode,
+				"action":  action,
+				"env":     envName,
+				"before":  change.Change.Before,
+				"after":   change.Change.After,
+			}
+			for _, name := range names {
+				value, err := policies[name].eval(ctx)
+				if err != nil {
+					return nil, fmt.Errorf("policy.%s: %s: %s", name, change.Address, err)
+				}
+				denied, err := policyTruthy(value)
+				if err != nil {
+					return nil, fmt.Errorf("policy.%s: %s: %s", name, change.Address, err)
+				}
+				if denied {
+					message := conf.Policies[name].Message
+					if len(message) == 0 {
+						message = "denied"
+					}
+					violations = append(violations, PolicyViolation{name, change.Address, action, message})
+				}
+			}
+		}
+	}
+	return violations, nil
+}
@@ -0,0 +1,76 @@
+package libtf
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func evalPolicy(t *testing.T, input string, ctx map[string]interface{}) interface{} {
+	expr, err := ParsePolicy(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := expr.eval(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return value
+}
+
+func TestPolicyExpressions(t *testing.T) {
+	ctx := map[string]interface{}{
+		"type":   "aws_db_instance",
+		"action": "delete",
+		"env":    "staging",
+		"after": map[string]interface{}{
+			"memory": 2048,
+			"tags":   map[string]interface{}{"owner": "team"},
+			"ports":  []interface{}{80, 443},
+		},
+	}
+	assert.Equal(t, true, evalPolicy(t, `type == "aws_db_instance" && action == "delete"`, ctx))
+	assert.Equal(t, false, evalPolicy(t, `env in ["prod", 'production']`, ctx))
+	assert.Equal(t, true, evalPolicy(t, `env != "prod" && after.memory > 1024`, ctx))
+	assert.Equal(t, true, evalPolicy(t, `"owner" in after.tags && !has(after.tags.cost)`, ctx))
+	assert.Equal(t, true, evalPolicy(t, `type =~ "^aws_(db|rds)_" || false`, ctx))
+	assert.Equal(t, true, evalPolicy(t, `after.ports[1] == 443 && len(after.ports) == 2`, ctx))
+	assert.Equal(t, false, evalPolicy(t, `startswith(type, "google_") || (after.missing.key == 1)`, ctx))
+	assert.Equal(t, nil, evalPolicy(t, `before.tags`, ctx))
+
+	for _, input := range []string{
+		`type ==`,
+		`unknown == "x"`,
+		`type == "x`,
+		`nope(type)`,
+		`has(type, name)`,
+		`type =~ "("`,
+		`(type == "x"`,
+	} {
+		_, err := ParsePolicy(input)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestCheckPolicies(t *testing.T) {
+	conf := HclConf{Policies: map[string]hclConfPolicy{
+		"no-db-destroy": {
+			Deny:    `type == "aws_db_instance" && action == "delete"`,
+			Message: "databases must not be destroyed",
+		},
+		"ecs-memory": {
+			Deny: `env != "prod" && type == "aws_ecs_task_definition" && after.memory > 512`,
+		},
+	}}
+	plan := []byte(`{"resource_changes": [
+		{"address": "aws_db_instance.main", "type": "aws_db_instance", "change": {"actions": ["delete", "create"]}},
+		{"address": "aws_ecs_task_definition.web", "type": "aws_ecs_task_definition", "change": {"actions": ["update"], "after": {"memory": 1024}}},
+		{"address": "aws_s3_bucket.logs", "type": "aws_s3_bucket", "change": {"actions": ["no-op"]}}
+	]}`)
+	violations, err := conf.CheckPolicies(plan, "staging")
+	assert.Nil(t, err)
+	assert.Equal(t, []PolicyViolation{
+		{"no-db-destroy", "aws_db_instance.main", "delete", "databases must not be destroyed"},
+		{"ecs-memory", "aws_ecs_task_definition.web", "update", "denied"},
+	}, violations)
+}
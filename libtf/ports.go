@@ -0,0 +1,140 @@
+package libtf
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type hclConfPort struct {
+	Container int    `hcl:"container"`
+	Host      int    `hcl:"host"`
+	Protocol  string `hcl:"protocol"`
+}
+
+func parsePort(value string) (hclConfPort, error) {
+	port := hclConfPort{}
+	if idx := strings.Index(value, "/"); idx >= 0 {
+		port.Protocol = value[idx+1:]
+		if len(port.Protocol) == 0 {
+			return port, fmt.Errorf("invalid port %s", value)
+		}
+		value = value[:idx]
+	}
+	parts := strings.Split(value, ":")
+	if len(parts) > 2 {
+		return port, fmt.Errorf("invalid port %s", value)
+	}
+	for idx, part := range parts {
+		number, err := strconv.Atoi(part)
+		if err != nil {
+			return port, fmt.Errorf("invalid port %s", value)
+		}
+		if idx == len(parts)-1 {
+			port.Container = number
+		} else {
+			port.Host = number
+		}
+	}
+	return port, nil
+}
+
+func (service *hclConfService) servicePorts() ([]hclConfPort, error) {
+	ports := []hclConfPort{}
+	for _, value := range service.Ports {
+		var port hclConfPort
+		switch value.(type) {
+		case int:
+			port.Container = value.(int)
+		case int64:
+			port.Container = int(value.(int64))
+		case float64:
+			port.Container = int(value.(float64))
+		case string:
+			var err error
+			if port, err = parsePort(value.(string)); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("expected port number or string, got %#v", value)
+		}
+		ports = append(ports, port)
+	}
+	names := []string{}
+	for name := range service.PortDefs {
+		names = append(names, name)
+	}
+	sort.Sort(ByString(names))
+	for _, name := range names {
+		ports = append(ports, service.PortDefs[name])
+	}
+	for _, port := range ports {
+		switch port.Protocol {
+		case "", "tcp", "udp":
+		default:
+			return nil, fmt.Errorf("unknown protocol %s", port.Protocol)
+		}
+		if port.Container <= 0 || port.Container > 65535 || port.Host < 0 || port.Host > 65535 {
+			return nil, fmt.Errorf("port %d:%d is out of range", port.Host, port.Container)
+		}
+	}
+	return ports, nil
+}
+
+func ecsHostPort(mode string, port hclConfPort) (int, error) {
+	if mode == "bridge" {
+		return port.Host, nil
+	}
+	if port.Host != 0 && port.Host != port.Container {
+		return 0, fmt.Errorf("host port %d must match container port %d in %s network mode", port.Host, port.Container, mode)
+	}
+	return port.Container, nil
+}
+
+func (conf *HclConf) validatePorts() error {
+	used := map[string]string{}
+	for _, name := range conf.serviceNames() {
+		service := conf.Services[name]
+		ports, err := service.servicePorts()
+		if err != nil {
+			return fmt.Errorf("services.%s.ports %s", name, err)
+		}
+		if len(service.Ecs) == 0 {
+			continue
+		}
+		for _, port := range ports {
+			hostPort, err := ecsHostPort(conf.serviceNetwork(&service).Mode, port)
+			if err != nil {
+				return fmt.Errorf("services.%s.ports %s", name, err)
+			}
+			if hostPort == 0 {
+				continue
+			}
+			protocol := port.Protocol
+			if len(protocol) == 0 {
+				protocol = "tcp"
+			}
+			key := fmt.Sprintf("%s/%d/%s", service.Ecs, hostPort, protocol)
+			if other, found := used[key]; found {
+				return fmt.Errorf("services.%s and services.%s both use host port %d/%s in ecs %s", other, name, hostPort, protocol, service.Ecs)
+			}
+			used[key] = name
+		}
+	}
+	return nil
+}
+
+func (port hclConfPort) asCompose() interface{} {
+	if port.Host == 0 && len(port.Protocol) == 0 {
+		return port.Container
+	}
+	value := strconv.Itoa(port.Container)
+	if port.Host != 0 {
+		value = fmt.Sprintf("%d:%s", port.Host, value)
+	}
+	if len(port.Protocol) != 0 {
+		value = fmt.Sprintf("%s/%s", value, port.Protocol)
+	}
+	return value
+}
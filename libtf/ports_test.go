@@ -0,0 +1,80 @@
+package libtf
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+func TestParsePort(t *testing.T) {
+	port, err := parsePort("8080:80/udp")
+	assert.Nil(t, err)
+	assert.Equal(t, hclConfPort{Container: 80, Host: 8080, Protocol: "udp"}, port)
+
+	port, err = parsePort("80")
+	assert.Nil(t, err)
+	assert.Equal(t, hclConfPort{Container: 80}, port)
+
+	for _, value := range []string{"a:80", "1:2:3", "80/"} {
+		_, err := parsePort(value)
+		if err == nil {
+			service := hclConfService{Ports: []interface{}{value}}
+			_, err = service.servicePorts()
+		}
+		assert.Error(t, err, value)
+	}
+}
+
+func TestServicePorts(t *testing.T) {
+	conf, _ := loadTestConf(t, `
+service "web" {
+  ecs     = "web"
+  compose = true
+  memory  = 128
+  ports   = [80, "8443:443"]
+  port "dns" {
+    container = 53
+    host      = 5353
+    protocol  = "udp"
+  }
+}
+`)
+	conf.Global = hclConfGlobal{BaseImage: "app", ProjectName: "test"}
+	assert.Nil(t, conf.validatePorts())
+
+	web := conf.Services["web"]
+	vault := testVault("test")
+	web.Image = "web"
+	assert.Equal(t, []ecsPortMapping{
+		{ContainerPort: 53, HostPort: 5353, Protocol: "udp"},
+		{ContainerPort: 80},
+		{ContainerPort: 443, HostPort: 8443},
+	}, web.asEcs(&conf, vault, nil).PortMappings)
+	assert.Equal(t, []interface{}{80, "8443:443", "5353:53/udp"}, web.asCompose(&conf, vault).Ports)
+	data, err := yaml.Marshal(composeServiceConfig{Ports: []interface{}{hclConfPort{Container: 80}.asCompose()}})
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), "ports:\n- 80\n")
+
+	conf.Global.Network.Mode = "awsvpc"
+	assert.Error(t, conf.validatePorts())
+
+	web.PortDefs = nil
+	conf.Services["web"] = web
+	assert.Error(t, conf.validatePorts())
+	web.Ports = []interface{}{80, 443}
+	conf.Services["web"] = web
+	assert.Nil(t, conf.validatePorts())
+	assert.Equal(t, 443, web.asEcs(&conf, vault, nil).PortMappings[1].HostPort)
+
+	conf.Services["api"] = hclConfService{Name: "api", Ecs: "web", Ports: []interface{}{"443"}}
+	err = conf.validatePorts()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "services.api and services.web both use host port 443/tcp")
+
+	conf.Global.Network.Mode = "bridge"
+	assert.Nil(t, conf.validatePorts())
+	conf.Services["api"] = hclConfService{Name: "api", Ecs: "web", Ports: []interface{}{"8443:443"}}
+	conf.Services["web"] = hclConfService{Name: "web", Ecs: "web", Ports: []interface{}{"8443:80"}}
+	assert.Error(t, conf.validatePorts())
+}
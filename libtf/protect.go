@@ -0,0 +1,36 @@
+package libtf
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+func (conf *HclConf) IsProtected(envName string) bool {
+	for _, name := range conf.ProtectedEnvs {
+		if name == envName {
+			return true
+		}
+	}
+	return false
+}
+
+func ConfirmEnv(envName string, yes bool, in io.Reader, out io.Writer) error {
+	if yes {
+		if os.Getenv("TF_CONFIRM_ENV") == envName {
+			return nil
+		}
+		return fmt.Errorf("%s is protected, -yes requires TF_CONFIRM_ENV=%s", envName, envName)
+	}
+	fmt.Fprintf(out, "%s is protected, type its name to continue: ", envName)
+	line, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if strings.TrimSpace(line) != envName {
+		return fmt.Errorf("confirmation does not match %s", envName)
+	}
+	return nil
+}
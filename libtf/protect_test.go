@@ -0,0 +1,30 @@
+package libtf
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfirmEnv(t *testing.T) {
+	conf := HclConf{ProtectedEnvs: []string{"prod"}}
+	assert.True(t, conf.IsProtected("prod"))
+	assert.False(t, conf.IsProtected("staging"))
+
+	out := &bytes.Buffer{}
+	assert.Nil(t, ConfirmEnv("prod", false, strings.NewReader("prod\n"), out))
+	assert.Contains(t, out.String(), "prod is protected")
+	assert.Error(t, ConfirmEnv("prod", false, strings.NewReader("staging\n"), out))
+	assert.Error(t, ConfirmEnv("prod", false, strings.NewReader(""), out))
+
+	os.Unsetenv("TF_CONFIRM_ENV")
+	assert.Error(t, ConfirmEnv("prod", true, strings.NewReader(""), out))
+	os.Setenv("TF_CONFIRM_ENV", "staging")
+	assert.Error(t, ConfirmEnv("prod", true, strings.NewReader(""), out))
+	os.Setenv("TF_CONFIRM_ENV", "prod")
+	assert.Nil(t, ConfirmEnv("prod", true, strings.NewReader(""), out))
+	os.Unsetenv("TF_CONFIRM_ENV")
+}
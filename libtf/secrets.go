@@ -0,0 +1,163 @@
+package libtf
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+)
+
+type secretStore interface {
+	Put(name string, value string) (string, error)
+	Arn(name string) (string, error)
+}
+
+type ssmSecretStore struct {
+	client ssmiface.SSMAPI
+}
+
+func (store ssmSecretStore) Put(name string, value string) (string, error) {
+	if _, err := store.client.PutParameter(&ssm.PutParameterInput{
+		Name:      aws.String(name),
+		Value:     aws.String(value),
+		Type:      aws.String(ssm.ParameterTypeSecureString),
+		Overwrite: aws.Bool(true),
+	}); err != nil {
+		return "", err
+	}
+	output, err := store.client.GetParameter(&ssm.GetParameterInput{
+		Name: aws.String(name),
+	})
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(output.Parameter.ARN), nil
+}
+
+func (store ssmSecretStore) Arn(name string) (string, error) {
+	output, err := store.client.GetParameter(&ssm.GetParameterInput{
+		Name: aws.String(name),
+	})
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(output.Parameter.ARN), nil
+}
+
+type secretsManagerSecretStore struct {
+	client secretsmanageriface.SecretsManagerAPI
+}
+
+func (store secretsManagerSecretStore) Put(name string, value string) (string, error) {
+	created, err := store.client.CreateSecret(&secretsmanager.CreateSecretInput{
+		Name:         aws.String(name),
+		SecretString: aws.String(value),
+	})
+	if err == nil {
+		return aws.StringValue(created.ARN), nil
+	}
+	if awsErr, ok := err.(awserr.Error); !ok || awsErr.Code() != secretsmanager.ErrCodeResourceExistsException {
+		return "", err
+	}
+	updated, err := store.client.PutSecretValue(&secretsmanager.PutSecretValueInput{
+		SecretId:     aws.String(name),
+		SecretString: aws.String(value),
+	})
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(updated.ARN), nil
+}
+
+func (store secretsManagerSecretStore) Arn(name string) (string, error) {
+	output, err := store.client.DescribeSecret(&secretsmanager.DescribeSecretInput{
+		SecretId: aws.String(name),
+	})
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(output.ARN), nil
+}
+
+func SecretName(envName string, projectName string, key string) string {
+	return fmt.Sprintf("/%s/%s/%s", envName, projectName, key)
+}
+
+func newSecretStore(kind string, vault Vault) (secretStore, error) {
+	switch kind {
+	case "ssm":
+		return ssmSecretStore{ssm.New(newSession(vault, vault.AwsRegion()))}, nil
+	case "secretsmanager":
+		return secretsManagerSecretStore{secretsmanager.New(newSession(vault, vault.AwsRegion()))}, nil
+	default:
+		return nil, fmt.Errorf("unknown secrets store %s", kind)
+	}
+}
+
+var secretExcludedKeys = map[string]bool{
+	"aws_key":    true,
+	"aws_secret": true,
+}
+
+func (conf *HclConf) secretKeys(vault Vault) []string {
+	res := []string{}
+	for _, key := range conf.SortedEnvKeys {
+		if secretExcludedKeys[key] {
+			continue
+		}
+		if _, found := vault.Raw[EnvKey(key)]; found && conf.Env[key].Sensitive {
+			res = append(res, key)
+		}
+	}
+	return res
+}
+
+func (conf *HclConf) pushSecrets(store secretStore, vault Vault) (map[string]string, error) {
+	res := map[string]string{}
+	for _, key := range conf.secretKeys(vault) {
+		arn, err := store.Put(SecretName(vault.EnvName(), conf.Global.ProjectName, key), vault.Raw[EnvKey(key)])
+		if err != nil {
+			return nil, fmt.Errorf("can't store %s: %s", key, err)
+		}
+		res[EnvKey(key)] = arn
+	}
+	return res, nil
+}
+
+func (conf *HclConf) secretArns(store secretStore, vault Vault) (map[string]string, error) {
+	res := map[string]string{}
+	for _, key := range conf.secretKeys(vault) {
+		arn, err := store.Arn(SecretName(vault.EnvName(), conf.Global.ProjectName, key))
+		if err != nil {
+			return nil, fmt.Errorf("can't find %s, run tf secrets push: %s", key, err)
+		}
+		res[EnvKey(key)] = arn
+	}
+	return res, nil
+}
+
+func (conf *HclConf) EcsSecrets(vault Vault) (map[string]string, error) {
+	if len(conf.Global.Secrets) == 0 {
+		return nil, nil
+	}
+	store, err := newSecretStore(conf.Global.Secrets, vault)
+	if err != nil {
+		return nil, err
+	}
+	return conf.secretArns(store, vault)
+}
+
+func (conf *HclConf) PushSecrets(vault Vault) (map[string]string, error) {
+	if len(conf.Global.Secrets) == 0 {
+		return nil, nil
+	}
+	store, err := newSecretStore(conf.Global.Secrets, vault)
+	if err != nil {
+		return nil, err
+	}
+	return conf.pushSecrets(store, vault)
+}
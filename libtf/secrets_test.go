@@ -0,0 +1,203 @@
+package libtf
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeAwsAPI struct {
+	values map[string]string
+	calls  []string
+}
+
+func (api *fakeAwsAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	action := r.Header.Get("X-Amz-Target")
+	api.calls = append(api.calls, action)
+	input := map[string]string{}
+	json.NewDecoder(r.Body).Decode(&input)
+
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	reply := func(status int, body map[string]interface{}) {
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(body)
+	}
+	fail := func(code string) {
+		reply(http.StatusBadRequest, map[string]interface{}{"__type": code, "message": code})
+	}
+
+	switch action {
+	case "AmazonSSM.PutParameter":
+		if input["Type"] != ssm.ParameterTypeSecureString {
+			fail("ValidationException")
+			return
+		}
+		api.values[input["Name"]] = input["Value"]
+		reply(http.StatusOK, map[string]interface{}{"Version": 1})
+	case "AmazonSSM.GetParameter":
+		if _, found := api.values[input["Name"]]; !found {
+			fail(ssm.ErrCodeParameterNotFound)
+			return
+		}
+		reply(http.StatusOK, map[string]interface{}{"Parameter": map[string]interface{}{
+			"ARN":  "arn:aws:ssm:us-east-1:1:parameter" + input["Name"],
+			"Name": input["Name"],
+		}})
+	case "secretsmanager.CreateSecret":
+		if _, found := api.values[input["Name"]]; found {
+			fail(secretsmanager.ErrCodeResourceExistsException)
+			return
+		}
+		api.values[input["Name"]] = input["SecretString"]
+		reply(http.StatusOK, map[string]interface{}{"ARN": "arn:sm" + input["Name"], "Name": input["Name"]})
+	case "secretsmanager.PutSecretValue":
+		api.values[input["SecretId"]] = input["SecretString"]
+		reply(http.StatusOK, map[string]interface{}{"ARN": "arn:sm" + input["SecretId"], "Name": input["SecretId"]})
+	case "secretsmanager.DescribeSecret":
+		if _, found := api.values[input["SecretId"]]; !found {
+			fail(secretsmanager.ErrCodeResourceNotFoundException)
+			return
+		}
+		reply(http.StatusOK, map[string]interface{}{"ARN": "arn:sm" + input["SecretId"], "Name": input["SecretId"]})
+	default:
+		fail("UnknownOperationException")
+	}
+}
+
+func (api *fakeAwsAPI) writes() int {
+	res := 0
+	for _, call := range api.calls {
+		if strings.HasSuffix(call, "PutParameter") || strings.HasSuffix(call, "CreateSecret") || strings.HasSuffix(call, "PutSecretValue") {
+			res++
+		}
+	}
+	return res
+}
+
+func fakeAwsSession(t *testing.T, values map[string]string) (*fakeAwsAPI, *session.Session, func()) {
+	api := &fakeAwsAPI{values: values}
+	server := httptest.NewServer(api)
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Endpoint:    aws.String(server.URL),
+		Credentials: credentials.NewStaticCredentials("key", "secret", ""),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return api, sess, server.Close
+}
+
+func secretsTestConf() (HclConf, Vault) {
+	conf := HclConf{
+		Global: hclConfGlobal{BaseImage: "app", ProjectName: "shop"},
+		Env: map[string]hclConfVariable{
+			"db_password": {Type: "string", Sensitive: true},
+			"debug":       {Type: "bool"},
+		},
+		Services: map[string]hclConfService{
+			"web": {Image: "web", Ecs: "web", Memory: 128, NoLog: true},
+		},
+	}
+	conf.finish()
+	vault := Vault{Env: map[string]interface{}{
+		"env_name":    "staging",
+		"aws_region":  "us-east-1",
+		"aws_key":     "key",
+		"aws_secret":  "secret",
+		"db_password": "hunter2",
+		"debug":       false,
+	}}
+	vault.Raw, _ = structToEnv(vault.Env)
+	return conf, vault
+}
+
+func TestSecretKeysSkipAwsCredentials(t *testing.T) {
+	conf, vault := secretsTestConf()
+	assert.Equal(t, []string{"db_password"}, conf.secretKeys(vault))
+
+	conf.Env["aws_key"] = hclConfVariable{Type: "string", Sensitive: true}
+	conf.Env["aws_secret"] = hclConfVariable{Type: "string", Sensitive: true}
+	assert.Equal(t, []string{"db_password"}, conf.secretKeys(vault))
+
+	api, sess, done := fakeAwsSession(t, map[string]string{})
+	defer done()
+	_, err := conf.pushSecrets(ssmSecretStore{ssm.New(sess)}, vault)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"/staging/shop/db_password": "hunter2"}, api.values)
+}
+
+func TestPushSecretsSSM(t *testing.T) {
+	conf, vault := secretsTestConf()
+	api, sess, done := fakeAwsSession(t, map[string]string{})
+	defer done()
+	store := ssmSecretStore{ssm.New(sess)}
+
+	_, err := conf.secretArns(store, vault)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "run tf secrets push")
+	assert.Equal(t, 0, api.writes())
+
+	secrets, err := conf.pushSecrets(store, vault)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{
+		"/staging/shop/db_password": "hunter2",
+	}, api.values)
+	assert.Equal(t, "arn:aws:ssm:us-east-1:1:parameter/staging/shop/db_password", secrets["TF_VAR_db_password"])
+
+	writes := api.writes()
+	arns, err := conf.secretArns(store, vault)
+	assert.Nil(t, err)
+	assert.Equal(t, secrets, arns)
+	assert.Equal(t, writes, api.writes())
+
+	web := conf.Services["web"]
+	ecs := web.asEcs(&conf, vault, arns)
+	for _, variable := range ecs.Environment {
+		assert.NotEqual(t, "TF_VAR_db_password", variable.Name)
+	}
+	assert.Contains(t, ecs.Environment, ecsEnvVariable{Name: "TF_VAR_debug", Value: "false"})
+	assert.Equal(t, []ecsSecret{
+		{Name: "TF_VAR_db_password", ValueFrom: "arn:aws:ssm:us-east-1:1:parameter/staging/shop/db_password"},
+	}, ecs.Secrets)
+}
+
+func TestPushSecretsSecretsManager(t *testing.T) {
+	conf, vault := secretsTestConf()
+	api, sess, done := fakeAwsSession(t, map[string]string{
+		"/staging/shop/db_password": "old",
+	})
+	defer done()
+	store := secretsManagerSecretStore{secretsmanager.New(sess)}
+
+	arns, err := conf.secretArns(store, vault)
+	assert.Nil(t, err)
+	assert.Equal(t, "arn:sm/staging/shop/db_password", arns["TF_VAR_db_password"])
+	assert.Equal(t, "old", api.values["/staging/shop/db_password"])
+
+	secrets, err := conf.pushSecrets(store, vault)
+	assert.Nil(t, err)
+	assert.Equal(t, "hunter2", api.values["/staging/shop/db_password"])
+	assert.Equal(t, "arn:sm/staging/shop/db_password", secrets["TF_VAR_db_password"])
+	assert.NotContains(t, secrets, "TF_VAR_aws_key")
+
+	writes := api.writes()
+	arns, err = conf.secretArns(store, vault)
+	assert.Nil(t, err)
+	assert.Equal(t, secrets, arns)
+	assert.Equal(t, writes, api.writes())
+
+	conf.Global.Secrets = "vault"
+	err = conf.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "global.secrets")
+}
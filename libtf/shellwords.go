@@ -0,0 +1,97 @@
+package libtf
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+func splitShellWords(line string) ([]string, error) {
+	words := []string{}
+	word := strings.Builder{}
+	inWord := false
+	for idx := 0; idx < len(line); idx++ {
+		char := line[idx]
+		switch {
+		case char == ' ' || char == '\t' || char == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case char == '\\':
+			if idx+1 == len(line) {
+				return nil, errors.New("trailing backslash")
+			}
+			idx++
+			if line[idx] != '\n' {
+				word.WriteByte(line[idx])
+			}
+			inWord = true
+		case char == '\'':
+			end := strings.IndexByte(line[idx+1:], '\'')
+			if end < 0 {
+				return nil, errors.New("unbalanced single quote")
+			}
+			word.WriteString(line[idx+1 : idx+1+end])
+			idx += end + 1
+			inWord = true
+		case char == '"':
+			closed := false
+			for idx++; idx < len(line); idx++ {
+				if line[idx] == '"' {
+					closed = true
+					break
+				}
+				if line[idx] == '\\' && idx+1 < len(line) && strings.IndexByte("$`\"\\\n", line[idx+1]) >= 0 {
+					idx++
+					if line[idx] == '\n' {
+						continue
+					}
+				}
+				word.WriteByte(line[idx])
+			}
+			if !closed {
+				return nil, errors.New("unbalanced double quote")
+			}
+			inWord = true
+		default:
+			word.WriteByte(char)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+func (service *hclConfService) commandArgs() ([]string, error) {
+	switch service.Command.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		words, err := splitShellWords(service.Command.(string))
+		if err != nil {
+			return nil, err
+		}
+		if len(words) == 0 {
+			return nil, nil
+		}
+		return words, nil
+	case []interface{}:
+		args := []string{}
+		for _, item := range service.Command.([]interface{}) {
+			arg, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("expected string, got %#v", item)
+			}
+			args = append(args, arg)
+		}
+		return args, nil
+	case []string:
+		return service.Command.([]string), nil
+	default:
+		return nil, fmt.Errorf("expected string or list, got %#v", service.Command)
+	}
+}
@@ -0,0 +1,66 @@
+package libtf
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitShellWords(t *testing.T) {
+	cases := map[string][]string{
+		"":                        {},
+		"serve  --port 80":        {"serve", "--port", "80"},
+		`sh -c "a && b"`:          {"sh", "-c", "a && b"},
+		`echo 'it''s' "\"x\" \n"`: {"echo", "its", `"x" \n`},
+		`a\ b c`:                  {"a b", "c"},
+		`""`:                      {""},
+	}
+	for line, expected := range cases {
+		words, err := splitShellWords(line)
+		assert.Nil(t, err, line)
+		assert.Equal(t, expected, words, line)
+	}
+
+	for _, line := range []string{`sh -c "a`, `sh -c 'a`, `a\`} {
+		_, err := splitShellWords(line)
+		assert.Error(t, err, line)
+	}
+}
+
+func TestServiceCommand(t *testing.T) {
+	conf, _ := loadTestConf(t, `
+service "web" {
+  compose = true
+  command = "sh -c \"migrate && serve\""
+}
+service "worker" {
+  compose = true
+  command = ["celery", "worker", "-Q", "a b"]
+}
+service "db" {
+  compose = true
+}
+`)
+
+	web := conf.Services["web"]
+	args, err := web.commandArgs()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"sh", "-c", "migrate && serve"}, args)
+
+	worker := conf.Services["worker"]
+	args, err = worker.commandArgs()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"celery", "worker", "-Q", "a b"}, args)
+
+	db := conf.Services["db"]
+	args, err = db.commandArgs()
+	assert.Nil(t, err)
+	assert.Nil(t, args)
+
+	web.Command = `sh -c "unbalanced`
+	conf.Services["web"] = web
+	conf.Global = hclConfGlobal{BaseImage: "app", ProjectName: "test"}
+	err = conf.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "services.web.command")
+}
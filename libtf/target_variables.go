@@ -0,0 +1,258 @@
+package libtf
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	hcl2 "github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+var terraformVariableSchema = &hcl2.BodySchema{
+	Blocks: []hcl2.BlockHeaderSchema{
+		{Type: "variable", LabelNames: []string{"name"}},
+	},
+}
+
+var terraformVariableBodySchema = &hcl2.BodySchema{
+	Attributes: []hcl2.AttributeSchema{
+		{Name: "default"},
+	},
+}
+
+func ParseTargetVariables(dir string) (map[string]bool, error) {
+	return parseTargetVariables(dir, "")
+}
+
+func parseTargetVariables(dir string, skip string) (map[string]bool, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	parser := hclparse.NewParser()
+	res := map[string]bool{}
+	for _, item := range files {
+		if item.IsDir() || item.Name() == skip {
+			continue
+		}
+		filename := filepath.Join(dir, item.Name())
+		var file *hcl2.File
+		var diags hcl2.Diagnostics
+		switch {
+		case strings.HasSuffix(item.Name(), ".tf"):
+			file, diags = parser.ParseHCLFile(filename)
+		case strings.HasSuffix(item.Name(), ".tf.json"):
+			file, diags = parser.ParseJSONFile(filename)
+		default:
+			continue
+		}
+		if diags.HasErrors() {
+			return nil, diags
+		}
+		content, _, diags := file.Body.PartialContent(terraformVariableSchema)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+		for _, block := range content.Blocks {
+			body, _, diags := block.Body.PartialContent(terraformVariableBodySchema)
+			if diags.HasErrors() {
+				return nil, diags
+			}
+			_, hasDefault := body.Attributes["default"]
+			res[block.Labels[0]] = !hasDefault
+		}
+	}
+	return res, nil
+}
+
+var jsonVariableRef = regexp.MustCompile(`\bvar\.([A-Za-z_][A-Za-z0-9_-]*)`)
+
+func ParseTargetVariableRefs(dir string) (map[string]bool, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	parser := hclparse.NewParser()
+	res := map[string]bool{}
+	for _, item := range files {
+		if item.IsDir() {
+			continue
+		}
+		filename := filepath.Join(dir, item.Name())
+		switch {
+		case strings.HasSuffix(item.Name(), ".tf"):
+			file, diags := parser.ParseHCLFile(filename)
+			if diags.HasErrors() {
+				return nil, diags
+			}
+			hclsyntax.VisitAll(file.Body.(*hclsyntax.Body), func(node hclsyntax.Node) hcl2.Diagnostics {
+				expr, ok := node.(*hclsyntax.ScopeTraversalExpr)
+				if !ok || expr.Traversal.RootName() != "var" || len(expr.Traversal) < 2 {
+					return nil
+				}
+				if attr, ok := expr.Traversal[1].(hcl2.TraverseAttr); ok {
+					res[attr.Name] = true
+				}
+				return nil
+			})
+		case strings.HasSuffix(item.Name(), ".tf.json"):
+			data, err := ioutil.ReadFile(filename)
+			if err != nil {
+				return nil, err
+			}
+			for _, match := range jsonVariableRef.FindAllStringSubmatch(string(data), -1) {
+				res[match[1]] = true
+			}
+		}
+	}
+	return res, nil
+}
+
+func (conf *HclConf) TargetTerraformVariables(target string, filename string) ([]TerraformVariable, error) {
+	dir := conf.TargetDefs[target].Path
+	refs, err := ParseTargetVariableRefs(dir)
+	if err != nil {
+		return nil, err
+	}
+	declared, err := parseTargetVariables(dir, filename)
+	if err != nil {
+		return nil, err
+	}
+	res := []TerraformVariable{}
+	for _, variable := range conf.TerraformVariables() {
+		if _, found := declared[variable.Name]; refs[variable.Name] && !found {
+			res = append(res, variable)
+		}
+	}
+	return res, nil
+}
+
+func (conf *HclConf) isDependencyOutput(target string, name string) bool {
+	for _, dependency := range conf.TargetDefs[target].DependsOn {
+		if strings.HasPrefix(name, TargetOutputVar(dependency, "")) {
+			return true
+		}
+	}
+	return false
+}
+
+func (conf *HclConf) wrapperVariables(vault Vault) (map[string]bool, map[string]bool) {
+	passed := map[string]bool{}
+	checked := map[string]bool{}
+	for key := range vault.Env {
+		if _, found := conf.Env[key]; found {
+			passed[key] = true
+			_, isDefault := hclConfDefaultEnv[key]
+			checked[key] = !isDefault && key != "tf_state_bucket"
+		}
+	}
+	for _, group := range conf.EcsGroups() {
+		passed[EcsTemplateVar(group)] = true
+		checked[EcsTemplateVar(group)] = true
+		if _, found := conf.EcsTasks[group]; found {
+			passed[EcsTaskVar(group)] = true
+			checked[EcsTaskVar(group)] = true
+		}
+		if conf.usesLogRetention() {
+			passed[EcsLogGroupsVar(group)] = true
+		}
+		if len(conf.EcsVolumes(group)) != 0 {
+			passed[EcsVolumesVar(group)] = true
+			checked[EcsVolumesVar(group)] = true
+		}
+	}
+	for _, target := range conf.Targets {
+		passed[StateKeyVar(target)] = true
+	}
+	return passed, checked
+}
+
+func (conf *HclConf) CheckVariables(vault Vault) ([]string, error) {
+	passed, checked := conf.wrapperVariables(vault)
+	used := map[string]bool{}
+	problems := []string{}
+	for _, target := range conf.Targets {
+		declared, err := ParseTargetVariables(conf.TargetDefs[target].Path)
+		if err != nil {
+			return nil, err
+		}
+		names := []string{}
+		for name := range declared {
+			names = append(names, name)
+		}
+		sort.Sort(ByString(names))
+		for _, name := range names {
+			used[name] = true
+			if declared[name] && !passed[name] && !conf.isDependencyOutput(target, name) {
+				problems = append(problems, fmt.Sprintf("target.%s requires %s which is never set", target, name))
+			}
+		}
+	}
+
+	unused := []string{}
+	for name := range checked {
+		if checked[name] && !used[name] {
+			unused = append(unused, name)
+		}
+	}
+	sort.Sort(ByString(unused))
+	for _, name := range unused {
+		problems = append(problems, fmt.Sprintf("%s is passed but no target declares it", name))
+	}
+	return problems, nil
+}
+
+func (conf *HclConf) DeclaredVarsOnly(target string) bool {
+	return conf.Global.DeclaredVarsOnly || conf.TargetDefs[target].DeclaredVarsOnly
+}
+
+func (conf *HclConf) FilterDeclaredEnv(target string, env []string) ([]string, error) {
+	declared, err := ParseTargetVariables(conf.TargetDefs[target].Path)
+	if err != nil {
+		return nil, err
+	}
+	res := []string{}
+	for _, item := range env {
+		name := strings.SplitN(item, "=", 2)[0]
+		switch {
+		case strings.HasPrefix(name, "AWS_"):
+			res = append(res, item)
+		case strings.HasPrefix(name, EnvKey("")):
+			if _, found := declared[strings.TrimPrefix(name, EnvKey(""))]; found {
+				res = append(res, item)
+			}
+		}
+	}
+	return res, nil
+}
+
+func (conf *HclConf) TargetEnv(target string, env []string) ([]string, error) {
+	if !conf.DeclaredVarsOnly(target) {
+		return WithProcessEnv(env), nil
+	}
+	res, err := conf.FilterDeclaredEnv(target, env)
+	if err != nil {
+		return nil, err
+	}
+	declared, err := ParseTargetVariables(conf.TargetDefs[target].Path)
+	if err != nil {
+		return nil, err
+	}
+	processEnv := []string{}
+	for _, item := range os.Environ() {
+		name := strings.SplitN(item, "=", 2)[0]
+		if strings.HasPrefix(name, EnvKey("")) {
+			if _, found := declared[strings.TrimPrefix(name, EnvKey(""))]; !found {
+				continue
+			}
+		}
+		processEnv = append(processEnv, item)
+	}
+	return overrideEnv(processEnv, res), nil
+}
@@ -0,0 +1,168 @@
+package libtf
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckVariables(t *testing.T) {
+	dir := writeConfFiles(t, map[string]string{
+		"network/main.tf": `
+variable "env_name" {}
+variable "vpc_cidr" {}
+`,
+		"app/main.tf": `
+variable "ecs_web_template" {}
+variable "network_state_key" {}
+variable "network_vpc_id" {}
+variable "replicas" {
+  default = 1
+}
+`,
+		"app/vars.tf.json": `{"variable": {"db_password": {}}}`,
+	})
+
+	conf := HclConf{
+		Services: map[string]hclConfService{
+			"web": {Name: "web", Ecs: "web"},
+		},
+		Env: map[string]hclConfVariable{
+			"env_name":    {Type: "string"},
+			"db_password": {Type: "string"},
+			"dead_secret": {Type: "string"},
+		},
+		TargetDefs: map[string]hclConfTarget{
+			"network": {Path: filepath.Join(dir, "network")},
+			"app":     {Path: filepath.Join(dir, "app"), DependsOn: []string{"network"}},
+		},
+		Targets: []string{"app", "network"},
+	}
+	vault := Vault{Env: map[string]interface{}{
+		"env_name":    "staging",
+		"db_password": "secret",
+		"dead_secret": "secret",
+	}}
+
+	problems, err := conf.CheckVariables(vault)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"target.network requires vpc_cidr which is never set",
+		"dead_secret is passed but no target declares it",
+	}, problems)
+}
+
+func TestFilterDeclaredEnv(t *testing.T) {
+	dir := writeConfFiles(t, map[string]string{
+		"dns/main.tf": `
+variable "zone" {}
+variable "network_vpc_id" {}
+`,
+	})
+
+	conf := HclConf{
+		TargetDefs: map[string]hclConfTarget{
+			"dns": {Path: filepath.Join(dir, "dns"), DeclaredVarsOnly: true},
+		},
+	}
+	assert.True(t, conf.DeclaredVarsOnly("dns"))
+
+	env, err := conf.FilterDeclaredEnv("dns", []string{
+		"TF_VAR_zone=example.com",
+		"TF_VAR_db_password=secret",
+		"TF_VAR_network_vpc_id=vpc-1",
+		"git_version=abc",
+		"AWS_ACCESS_KEY_ID=key",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"TF_VAR_zone=example.com",
+		"TF_VAR_network_vpc_id=vpc-1",
+		"AWS_ACCESS_KEY_ID=key",
+	}, env)
+}
+
+func TestTargetTerraformVariables(t *testing.T) {
+	dir := writeConfFiles(t, map[string]string{
+		"app/main.tf": `
+variable "replicas" {
+  default = 1
+}
+
+resource "aws_ecs_task_definition" "web" {
+  container_definitions = file(var.ecs_web_template)
+  tags = {
+    env   = var.env_name
+    count = var.replicas
+  }
+}
+`,
+		"app/db.tf.json": `{"resource": {"aws_db_instance": {"db": {"password": "${var.db_password}"}}}}`,
+		"app/variables.tf": `
+variable "aws_region" {}
+variable "env_name" {}
+`,
+	})
+
+	conf := HclConf{
+		Services: map[string]hclConfService{
+			"web": {Name: "web", Ecs: "web"},
+		},
+		Env: map[string]hclConfVariable{
+			"env_name":    {Type: "string"},
+			"aws_region":  {Type: "string"},
+			"db_password": {Type: "string"},
+			"replicas":    {Type: "int"},
+		},
+		TargetDefs: map[string]hclConfTarget{
+			"app": {Path: filepath.Join(dir, "app")},
+		},
+		Targets: []string{"app"},
+	}
+
+	variables, err := conf.TargetTerraformVariables("app", "variables.tf")
+	assert.Nil(t, err)
+	names := []string{}
+	for _, variable := range variables {
+		names = append(names, variable.Name)
+	}
+	assert.Equal(t, []string{"db_password", "ecs_web_template", "env_name"}, names)
+}
+
+func TestTargetEnvOverridesProcessEnv(t *testing.T) {
+	dir := writeConfFiles(t, map[string]string{
+		"dns/main.tf": `variable "zone" {}`,
+	})
+
+	os.Setenv("TF_VAR_zone", "process.example.com")
+	os.Setenv("TF_VAR_db_password", "leaked")
+	os.Setenv("AWS_ACCESS_KEY_ID", "shell-key")
+	defer os.Unsetenv("TF_VAR_zone")
+	defer os.Unsetenv("TF_VAR_db_password")
+	defer os.Unsetenv("AWS_ACCESS_KEY_ID")
+
+	conf := HclConf{
+		TargetDefs: map[string]hclConfTarget{
+			"dns": {Path: filepath.Join(dir, "dns")},
+		},
+	}
+	wrapper := []string{"TF_VAR_zone=example.com", "AWS_ACCESS_KEY_ID=vault-key"}
+
+	env, err := conf.TargetEnv("dns", wrapper)
+	assert.Nil(t, err)
+	assert.Equal(t, wrapper, env[len(env)-2:])
+	assert.NotContains(t, env, "TF_VAR_zone=process.example.com")
+	assert.NotContains(t, env, "AWS_ACCESS_KEY_ID=shell-key")
+	assert.Contains(t, env, "TF_VAR_db_password=leaked")
+
+	conf.Global.DeclaredVarsOnly = true
+	env, err = conf.TargetEnv("dns", append(wrapper, "TF_VAR_db_password=secret"))
+	assert.Nil(t, err)
+	assert.Equal(t, wrapper, env[len(env)-2:])
+	assert.NotContains(t, env, "TF_VAR_zone=process.example.com")
+	assert.NotContains(t, env, "AWS_ACCESS_KEY_ID=shell-key")
+	assert.NotContains(t, env, "TF_VAR_db_password=secret")
+	assert.NotContains(t, env, "TF_VAR_db_password=leaked")
+}
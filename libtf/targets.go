@@ -0,0 +1,60 @@
+package libtf
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+func topoSort(nodes []string, edges map[string][]string) ([]string, error) {
+	remaining := map[string]int{}
+	dependents := map[string][]string{}
+	for _, node := range nodes {
+		remaining[node] = len(edges[node])
+		for _, dependency := range edges[node] {
+			dependents[dependency] = append(dependents[dependency], node)
+		}
+	}
+	ready := []string{}
+	for _, node := range nodes {
+		if remaining[node] == 0 {
+			ready = append(ready, node)
+		}
+	}
+	res := []string{}
+	for len(ready) > 0 {
+		sort.Sort(ByString(ready))
+		node := ready[0]
+		ready = ready[1:]
+		res = append(res, node)
+		for _, dependent := range dependents[node] {
+			remaining[dependent]--
+			if remaining[dependent] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+	}
+	if len(res) != len(nodes) {
+		cycle := []string{}
+		for _, node := range nodes {
+			if remaining[node] > 0 {
+				cycle = append(cycle, node)
+			}
+		}
+		sort.Sort(ByString(cycle))
+		return nil, fmt.Errorf("dependency cycle between %s", strings.Join(cycle, ", "))
+	}
+	return res, nil
+}
+
+func (conf *HclConf) TargetOrder() ([]string, error) {
+	edges := map[string][]string{}
+	for name, target := range conf.TargetDefs {
+		edges[name] = target.DependsOn
+	}
+	order, err := topoSort(conf.Targets, edges)
+	if err != nil {
+		return nil, fmt.Errorf("targets: %s", err)
+	}
+	return order, nil
+}
@@ -0,0 +1,22 @@
+package libtf
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopoSort(t *testing.T) {
+	res1, err1 := topoSort([]string{"app", "db", "dns", "network"}, map[string][]string{
+		"app": {"db", "network"},
+		"db":  {"network"},
+	})
+	assert.Nil(t, err1)
+	assert.Equal(t, []string{"dns", "network", "db", "app"}, res1)
+
+	_, err2 := topoSort([]string{"a", "b", "c"}, map[string][]string{
+		"a": {"b"},
+		"b": {"a"},
+	})
+	assert.EqualError(t, err2, "dependency cycle between a, b")
+}
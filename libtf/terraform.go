@@ -1,63 +1,130 @@
 package libtf
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 
 	"github.com/kyokomi/emoji"
 )
 
-func isTerraformTarget(name string) bool {
+func isTerraformTarget(name string) (bool, error) {
 	info, err := ioutil.ReadDir(name)
 	if err != nil {
-		panic(err)
+		return false, err
 	}
 	for _, item := range info {
 		if !item.IsDir() {
 			if strings.HasSuffix(item.Name(), ".tf") {
-				return true
+				return true, nil
 			}
 		}
 	}
-	return false
+	return false, nil
 }
 
-func findTerraformTargets() []string {
+func findTerraformTargets() ([]string, error) {
 	info, err := ioutil.ReadDir(".")
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	res := []string{}
 	for _, item := range info {
 		if item.IsDir() {
-			if isTerraformTarget(item.Name()) {
+			isTarget, err := isTerraformTarget(item.Name())
+			if err != nil {
+				if os.IsPermission(err) {
+					continue
+				}
+				return nil, err
+			}
+			if isTarget {
 				res = append(res, item.Name())
 			}
 		}
 	}
-	return res
+	return res, nil
+}
+
+const backendOverrideFile = "tf_backend_override.tf.json"
+
+func (conf *HclConf) backendOverride(vault Vault, target string) (map[string]interface{}, error) {
+	backend, err := conf.StateBackend()
+	if err != nil {
+		return nil, err
+	}
+	config, err := backend.Config(vault, target)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"terraform": map[string]interface{}{
+			"backend": map[string]interface{}{
+				backend.Type(): config,
+			},
+		},
+	}, nil
+}
+
+func (conf *HclConf) backendOverrideData(vault Vault, target string) ([]byte, error) {
+	override, err := conf.backendOverride(vault, target)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(override, "", "  ")
+}
+
+func (conf *HclConf) remoteStateReady(vault Vault, dir string, target string) (bool, error) {
+	if _, err := os.Stat(filepath.Join(dir, ".terraform")); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	data, err := conf.backendOverrideData(vault, target)
+	if err != nil {
+		return false, err
+	}
+	current, err := ioutil.ReadFile(filepath.Join(dir, backendOverrideFile))
+	if err != nil || !bytes.Equal(current, data) {
+		return false, nil
+	}
+	if conf.Global.Workspaces {
+		workspace, err := ioutil.ReadFile(filepath.Join(dir, ".terraform", "environment"))
+		if err != nil || strings.TrimSpace(string(workspace)) != vault.EnvName() {
+			return false, nil
+		}
+	}
+	return true, nil
 }
 
-func (vault *Vault) InitRemoteState(target string) {
+func (conf *HclConf) EnsureRemoteState(vault Vault, dir string, target string) error {
+	ready, err := conf.remoteStateReady(vault, dir, target)
+	if err != nil || ready {
+		return err
+	}
+	return conf.InitRemoteState(vault, dir, target)
+}
+
+func (conf *HclConf) InitRemoteState(vault Vault, dir string, target string) error {
 	emoji.Println(":pray: init remote state")
 
 	bin, err := exec.LookPath("terraform")
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	if err := RimRaf(".terraform"); err != nil {
-		panic(err)
+	data, err := conf.backendOverrideData(vault, target)
+	if err != nil {
+		return err
 	}
-
-	args := []string{
-		"remote", "config",
-		"-backend", "s3",
-		"-backend-config", fmt.Sprintf("bucket=%s", vault.stateBucket()),
-		"-backend-config", fmt.Sprintf("key=%s-%s.tfstate", vault.EnvName(), target),
+	if err := ioutil.WriteFile(filepath.Join(dir, backendOverrideFile), data, 0600); err != nil {
+		return err
 	}
 
 	env := []string{
@@ -66,18 +133,133 @@ func (vault *Vault) InitRemoteState(target string) {
 		fmt.Sprintf("AWS_DEFAULT_REGION=%s", vault.AwsRegion()),
 	}
 
-	cmd := exec.Command(bin, args...)
+	cmd := exec.Command(bin, "init", "-input=false", "-reconfigure")
 
-	cmd.Env = env
+	cmd.Dir = dir
+	cmd.Env = WithProcessEnv(env)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 
 	if err := cmd.Start(); err != nil {
-		panic(err)
+		return err
 	}
 
 	if err := cmd.Wait(); err != nil {
-		panic(err)
+		return err
 	}
+
+	if conf.Global.Workspaces {
+		if err := selectWorkspace(bin, dir, cmd.Env, vault.EnvName()); err != nil {
+			return err
+		}
+	}
+
 	emoji.Println(":ok_hand: remote state ready")
+	return nil
+}
+
+func overrideEnv(base []string, env []string) []string {
+	overridden := map[string]bool{}
+	for _, item := range env {
+		overridden[strings.SplitN(item, "=", 2)[0]] = true
+	}
+	res := []string{}
+	for _, item := range base {
+		if !overridden[strings.SplitN(item, "=", 2)[0]] {
+			res = append(res, item)
+		}
+	}
+	return append(res, env...)
+}
+
+func WithProcessEnv(env []string) []string {
+	return overrideEnv(os.Environ(), env)
+}
+
+func selectWorkspace(bin string, dir string, env []string, workspace string) error {
+	selectCmd := exec.Command(bin, "workspace", "select", workspace)
+	selectCmd.Dir = dir
+	selectCmd.Env = env
+	selectCmd.Stdout = os.Stdout
+	if err := selectCmd.Run(); err == nil {
+		return nil
+	}
+
+	newCmd := exec.Command(bin, "workspace", "new", workspace)
+	newCmd.Dir = dir
+	newCmd.Env = env
+	newCmd.Stdout = os.Stdout
+	newCmd.Stderr = os.Stderr
+	return newCmd.Run()
+}
+
+func (conf *HclConf) TerraformEnv(vault Vault, ecsDefs map[string]string) ([]string, error) {
+	backend, err := conf.StateBackend()
+	if err != nil {
+		return nil, err
+	}
+	vars := map[string]string{}
+	for key, value := range vault.Raw {
+		vars[key] = value
+	}
+	if conf.Global.TypedVars {
+		for key, value := range vault.Env {
+			switch value.(type) {
+			case []interface{}, map[string]interface{}:
+				str, err := terraformValueToString(value)
+				if err != nil {
+					return nil, err
+				}
+				vars[EnvKey(key)] = str
+			}
+		}
+	}
+	env := []string{}
+	for key, value := range vars {
+		env = append(env, fmt.Sprintf("%s=%s", key, value))
+	}
+	for key, value := range ecsDefs {
+		env = append(env, fmt.Sprintf("%s=%s", EnvKey(key), value))
+	}
+	for _, target := range conf.Targets {
+		env = append(env, fmt.Sprintf("%s=%s", EnvKey(StateKeyVar(target)), backend.StateRef(vault, target)))
+	}
+	return append(env, []string{
+		fmt.Sprintf("AWS_ACCESS_KEY_ID=%s", vault.AwsKey()),
+		fmt.Sprintf("AWS_SECRET_ACCESS_KEY=%s", vault.AwsSecret()),
+		fmt.Sprintf("AWS_DEFAULT_REGION=%s", vault.AwsRegion()),
+	}...), nil
+}
+
+func (conf *HclConf) DeleteState(vault Vault, target string) error {
+	if !conf.Global.Workspaces {
+		backend, err := conf.StateBackend()
+		if err != nil {
+			return err
+		}
+		return backend.DeleteState(vault, target)
+	}
+
+	bin, err := exec.LookPath("terraform")
+	if err != nil {
+		return err
+	}
+	env, err := conf.TerraformEnv(vault, nil)
+	if err != nil {
+		return err
+	}
+	for _, args := range [][]string{
+		{"workspace", "select", "default"},
+		{"workspace", "delete", vault.EnvName()},
+	} {
+		cmd := exec.Command(bin, args...)
+		cmd.Dir = conf.TargetDefs[target].Path
+		cmd.Env = WithProcessEnv(env)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return err
+		}
+	}
+	return nil
 }
@@ -0,0 +1,125 @@
+package libtf
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const fakeTerraformScript = `#!/bin/sh
+echo "$@" >> "$TF_FAKE_LOG"
+mkdir -p .terraform
+`
+
+func fakeTerraform(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "tf-fake")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "terraform"), []byte(fakeTerraformScript), 0700); err != nil {
+		t.Fatal(err)
+	}
+	log := filepath.Join(dir, "calls.log")
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+	os.Setenv("TF_FAKE_LOG", log)
+	return log, func() {
+		os.Setenv("PATH", path)
+		os.Unsetenv("TF_FAKE_LOG")
+		os.RemoveAll(dir)
+	}
+}
+
+func terraformCalls(t *testing.T, log string) []string {
+	data, err := ioutil.ReadFile(log)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
+
+func TestEnsureRemoteState(t *testing.T) {
+	log, cleanup := fakeTerraform(t)
+	defer cleanup()
+
+	dir := writeConfFiles(t, map[string]string{"network/main.tf": ""})
+	target := filepath.Join(dir, "network")
+
+	conf := HclConf{}
+	staging := Vault{Env: map[string]interface{}{
+		"env_name":        "staging",
+		"aws_key":         "key",
+		"aws_secret":      "secret",
+		"aws_region":      "eu-west-1",
+		"tf_state_bucket": "states",
+	}}
+
+	assert.Nil(t, conf.EnsureRemoteState(staging, target, "network"))
+	assert.Nil(t, conf.EnsureRemoteState(staging, target, "network"))
+	assert.Equal(t, []string{"init -input=false -reconfigure"}, terraformCalls(t, log))
+
+	production := Vault{Env: map[string]interface{}{
+		"env_name":        "production",
+		"aws_key":         "key",
+		"aws_secret":      "secret",
+		"aws_region":      "eu-west-1",
+		"tf_state_bucket": "states",
+	}}
+	assert.Nil(t, conf.EnsureRemoteState(production, target, "network"))
+	assert.Len(t, terraformCalls(t, log), 2)
+}
+
+func TestInitRemoteState(t *testing.T) {
+	log, cleanup := fakeTerraform(t)
+	defer cleanup()
+
+	dir := writeConfFiles(t, map[string]string{"app/main.tf": ""})
+	target := filepath.Join(dir, "app")
+
+	vault := Vault{Env: map[string]interface{}{
+		"env_name":            "staging",
+		"aws_key":             "key",
+		"aws_secret":          "secret",
+		"aws_region":          "eu-west-1",
+		"tf_state_bucket":     "states",
+		"tf_state_lock_table": "locks",
+	}}
+
+	conf := HclConf{}
+	assert.Nil(t, conf.InitRemoteState(vault, target, "app"))
+
+	data, err := ioutil.ReadFile(filepath.Join(target, backendOverrideFile))
+	assert.Nil(t, err)
+	override := map[string]interface{}{}
+	assert.Nil(t, json.Unmarshal(data, &override))
+	assert.Equal(t, map[string]interface{}{
+		"terraform": map[string]interface{}{
+			"backend": map[string]interface{}{
+				"s3": map[string]interface{}{
+					"bucket":         "states",
+					"key":            "staging-app.tfstate",
+					"region":         "eu-west-1",
+					"encrypt":        true,
+					"dynamodb_table": "locks",
+				},
+			},
+		},
+	}, override)
+	assert.Equal(t, []string{"init -input=false -reconfigure"}, terraformCalls(t, log))
+
+	conf.Global.Workspaces = true
+	assert.Nil(t, conf.InitRemoteState(vault, target, "app"))
+	assert.Equal(t, []string{
+		"init -input=false -reconfigure",
+		"init -input=false -reconfigure",
+		"workspace select staging",
+	}, terraformCalls(t, log))
+}
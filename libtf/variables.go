@@ -0,0 +1,127 @@
+package libtf
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type TerraformVariable struct {
+	Name        string
+	Type        string
+	Description string
+	Optional    bool
+	Sensitive   bool
+}
+
+type byTerraformVariableName []TerraformVariable
+
+func (a byTerraformVariableName) Len() int {
+	return len(a)
+}
+
+func (a byTerraformVariableName) Swap(i, j int) {
+	a[i], a[j] = a[j], a[i]
+}
+
+func (a byTerraformVariableName) Less(i, j int) bool {
+	return strings.Compare(a[i].Name, a[j].Name) == -1
+}
+
+var terraformTypes = map[string]string{
+	"string": "string",
+	"int":    "number",
+	"bool":   "bool",
+	"list":   "list(string)",
+	"dict":   "map(any)",
+}
+
+func (conf *HclConf) terraformType(kind string) string {
+	if !conf.Global.TypedVars && (kind == "list" || kind == "dict") {
+		return "string"
+	}
+	return terraformTypes[kind]
+}
+
+func (conf *HclConf) TerraformVariables() []TerraformVariable {
+	res := []TerraformVariable{}
+	for _, group := range conf.EcsGroups() {
+		res = append(res, TerraformVariable{
+			Name:        EcsTemplateVar(group),
+			Type:        "string",
+			Description: fmt.Sprintf("path to %s ecs container definitions", group),
+		})
+		if _, found := conf.EcsTasks[group]; found {
+			res = append(res, TerraformVariable{
+				Name:        EcsTaskVar(group),
+				Type:        "string",
+				Description: fmt.Sprintf("path to %s ecs task definition", group),
+			})
+		}
+		if conf.usesLogRetention() {
+			res = append(res, TerraformVariable{
+				Name:        EcsLogGroupsVar(group),
+				Type:        "string",
+				Description: fmt.Sprintf("path to %s ecs log groups", group),
+				Optional:    true,
+			})
+		}
+		if len(conf.EcsVolumes(group)) != 0 {
+			res = append(res, TerraformVariable{
+				Name:        EcsVolumesVar(group),
+				Type:        "string",
+				Description: fmt.Sprintf("path to %s ecs task volumes", group),
+			})
+		}
+	}
+	for _, target := range conf.Targets {
+		res = append(res, TerraformVariable{
+			Name:        StateKeyVar(target),
+			Type:        "string",
+			Description: fmt.Sprintf("state key of %s target", target),
+		})
+	}
+	for name, variable := range conf.Env {
+		res = append(res, TerraformVariable{
+			Name:        name,
+			Type:        conf.terraformType(variable.Type),
+			Description: variable.Description,
+			Optional:    variable.Optional,
+			Sensitive:   variable.Sensitive,
+		})
+	}
+	sort.Sort(byTerraformVariableName(res))
+	return res
+}
+
+func RenderTerraformVariables(variables []TerraformVariable) []byte {
+	buf := &bytes.Buffer{}
+	for idx, variable := range variables {
+		attrs := [][2]string{{"type", variable.Type}}
+		if len(variable.Description) != 0 {
+			attrs = append(attrs, [2]string{"description", fmt.Sprintf("%q", variable.Description)})
+		}
+		if variable.Optional {
+			attrs = append(attrs, [2]string{"default", "null"})
+		}
+		if variable.Sensitive {
+			attrs = append(attrs, [2]string{"sensitive", "true"})
+		}
+		width := 0
+		for _, attr := range attrs {
+			if len(attr[0]) > width {
+				width = len(attr[0])
+			}
+		}
+		if idx != 0 {
+			buf.WriteString("\n")
+		}
+		fmt.Fprintf(buf, "variable %q {\n", variable.Name)
+		for _, attr := range attrs {
+			fmt.Fprintf(buf, "  %-*s = %s\n", width, attr[0], attr[1])
+		}
+		buf.WriteString("}\n")
+	}
+	return buf.Bytes()
+}
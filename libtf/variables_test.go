@@ -0,0 +1,66 @@
+package libtf
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderTerraformVariables(t *testing.T) {
+	conf := HclConf{
+		Services: map[string]hclConfService{
+			"web":    {Name: "web", Ecs: "app"},
+			"worker": {Name: "worker", Ecs: "app"},
+			"db":     {Name: "db", Compose: true},
+		},
+		Targets: []string{"network"},
+		Env: map[string]hclConfVariable{
+			"db_password": {Type: "string", Description: "database password", Sensitive: true},
+			"replicas":    {Type: "int", Optional: true},
+			"hosts":       {Type: "list"},
+		},
+	}
+	assert.Equal(t, `variable "db_password" {
+  type        = string
+  description = "database password"
+  sensitive   = true
+}
+
+variable "ecs_app_template" {
+  type        = string
+  description = "path to app ecs container definitions"
+}
+
+variable "hosts" {
+  type = string
+}
+
+variable "network_state_key" {
+  type        = string
+  description = "state key of network target"
+}
+
+variable "replicas" {
+  type    = number
+  default = null
+}
+`, string(RenderTerraformVariables(conf.TerraformVariables())))
+}
+
+func TestTypedTerraformVariables(t *testing.T) {
+	conf := HclConf{
+		Global: hclConfGlobal{TypedVars: true},
+		Env: map[string]hclConfVariable{
+			"hosts": {Type: "list"},
+			"tags":  {Type: "dict"},
+		},
+	}
+	assert.Equal(t, `variable "hosts" {
+  type = list(string)
+}
+
+variable "tags" {
+  type = map(any)
+}
+`, string(RenderTerraformVariables(conf.TerraformVariables())))
+}
@@ -34,7 +34,13 @@ func (vault *Vault) AwsSecret() string {
 }
 
 func (vault *Vault) stateBucket() string {
-	return vault.Env["tf_state_bucket"].(string)
+	stateBucket, _ := vault.Env["tf_state_bucket"].(string)
+	return stateBucket
+}
+
+func (vault *Vault) stateLockTable() string {
+	lockTable, _ := vault.Env["tf_state_lock_table"].(string)
+	return lockTable
 }
 
 func EnvKey(key string) string {
@@ -49,10 +55,26 @@ func StateKey(envName string, target string) string {
 	return fmt.Sprintf("%s-%s.tfstate", envName, target)
 }
 
+func WorkspaceStateKey(target string) string {
+	return fmt.Sprintf("%s.tfstate", target)
+}
+
 func EcsTemplateVar(service string) string {
 	return fmt.Sprintf("ecs_%s_template", service)
 }
 
+func EcsVolumesVar(service string) string {
+	return fmt.Sprintf("ecs_%s_volumes", service)
+}
+
+func EcsTaskVar(service string) string {
+	return fmt.Sprintf("ecs_%s_task", service)
+}
+
+func EcsLogGroupsVar(service string) string {
+	return fmt.Sprintf("ecs_%s_log_groups", service)
+}
+
 func (conf *HclConf) LoadEnv(vault *Vault) error {
 	res := map[string]interface{}{}
 	for _, key := range conf.SortedEnvKeys {
@@ -0,0 +1,248 @@
+package libtf
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type hclConfEfs struct {
+	FileSystemId      string `hcl:"file_system_id"`
+	RootDirectory     string `hcl:"root_directory"`
+	TransitEncryption bool   `hcl:"transit_encryption"`
+	AccessPointId     string `hcl:"access_point_id"`
+}
+
+type hclConfVolume struct {
+	Name     string
+	HostPath string      `hcl:"host_path"`
+	Driver   string      `hcl:"driver"`
+	Efs      *hclConfEfs `hcl:"efs"`
+}
+
+type hclConfMount struct {
+	Path     string `hcl:"path"`
+	ReadOnly bool   `hcl:"read_only"`
+}
+
+type ecsMountPoint struct {
+	SourceVolume  string `json:"sourceVolume"`
+	ContainerPath string `json:"containerPath"`
+	ReadOnly      bool   `json:"readOnly"`
+}
+
+type byEcsMountPath []ecsMountPoint
+
+func (a byEcsMountPath) Len() int {
+	return len(a)
+}
+
+func (a byEcsMountPath) Swap(i, j int) {
+	a[i], a[j] = a[j], a[i]
+}
+
+func (a byEcsMountPath) Less(i, j int) bool {
+	return strings.Compare(a[i].ContainerPath, a[j].ContainerPath) == -1
+}
+
+type ecsVolumeFrom struct {
+	SourceContainer string `json:"sourceContainer"`
+	ReadOnly        bool   `json:"readOnly"`
+}
+
+type ecsHostVolume struct {
+	SourcePath string `json:"sourcePath"`
+}
+
+type ecsDockerVolume struct {
+	Scope         string `json:"scope"`
+	Autoprovision bool   `json:"autoprovision"`
+	Driver        string `json:"driver,omitempty"`
+}
+
+type ecsEfsAuthorization struct {
+	AccessPointId string `json:"accessPointId"`
+	Iam           string `json:"iam"`
+}
+
+type ecsEfsVolume struct {
+	FileSystemId        string               `json:"fileSystemId"`
+	RootDirectory       string               `json:"rootDirectory,omitempty"`
+	TransitEncryption   string               `json:"transitEncryption,omitempty"`
+	AuthorizationConfig *ecsEfsAuthorization `json:"authorizationConfig,omitempty"`
+}
+
+type ecsVolume struct {
+	Name                      string           `json:"name"`
+	Host                      *ecsHostVolume   `json:"host,omitempty"`
+	DockerVolumeConfiguration *ecsDockerVolume `json:"dockerVolumeConfiguration,omitempty"`
+	EfsVolumeConfiguration    *ecsEfsVolume    `json:"efsVolumeConfiguration,omitempty"`
+}
+
+type composeVolume struct {
+	Driver string `yaml:"driver,omitempty"`
+}
+
+func parseVolumeFrom(value string) (string, bool) {
+	if strings.HasSuffix(value, ":ro") {
+		return strings.TrimSuffix(value, ":ro"), true
+	}
+	return value, false
+}
+
+func (volume *hclConfVolume) validate() error {
+	if len(volume.HostPath) != 0 && volume.Efs != nil {
+		return errors.New("can't have both host_path and efs")
+	}
+	if volume.Efs != nil && len(volume.Efs.FileSystemId) == 0 {
+		return errors.New("efs.file_system_id is not defined")
+	}
+	if len(volume.Driver) != 0 && (len(volume.HostPath) != 0 || volume.Efs != nil) {
+		return errors.New("driver is only supported for named volumes")
+	}
+	return nil
+}
+
+func (conf *HclConf) validateVolumes() error {
+	for name, volume := range conf.Volumes {
+		if err := volume.validate(); err != nil {
+			return fmt.Errorf("volume.%s %s", name, err)
+		}
+	}
+	for _, name := range conf.serviceNames() {
+		service := conf.Services[name]
+		for volume, mount := range service.Mounts {
+			if _, found := conf.Volumes[volume]; !found {
+				return fmt.Errorf("services.%s mounts unknown volume %s", name, volume)
+			}
+			if len(mount.Path) == 0 {
+				return fmt.Errorf("services.%s.mount.%s.path is not defined", name, volume)
+			}
+		}
+		for _, value := range service.VolumesFrom {
+			source, _ := parseVolumeFrom(value)
+			other, found := conf.Services[source]
+			if !found || source == name {
+				return fmt.Errorf("services.%s.volumes_from has invalid service %s", name, source)
+			}
+			if len(service.Ecs) != 0 && other.Ecs != service.Ecs {
+				return fmt.Errorf("services.%s.volumes_from %s is not in ecs %s", name, source, service.Ecs)
+			}
+		}
+	}
+	return nil
+}
+
+func (service *hclConfService) ecsMountPoints() []ecsMountPoint {
+	res := []ecsMountPoint{}
+	for volume, mount := range service.Mounts {
+		res = append(res, ecsMountPoint{
+			SourceVolume:  volume,
+			ContainerPath: mount.Path,
+			ReadOnly:      mount.ReadOnly,
+		})
+	}
+	sort.Sort(byEcsMountPath(res))
+	return res
+}
+
+func (service *hclConfService) ecsVolumesFrom() []ecsVolumeFrom {
+	res := []ecsVolumeFrom{}
+	for _, value := range service.VolumesFrom {
+		source, readOnly := parseVolumeFrom(value)
+		res = append(res, ecsVolumeFrom{
+			SourceContainer: source,
+			ReadOnly:        readOnly,
+		})
+	}
+	return res
+}
+
+func (volume *hclConfVolume) asEcs() ecsVolume {
+	res := ecsVolume{Name: volume.Name}
+	switch {
+	case len(volume.HostPath) != 0:
+		res.Host = &ecsHostVolume{SourcePath: volume.HostPath}
+	case volume.Efs != nil:
+		res.EfsVolumeConfiguration = &ecsEfsVolume{
+			FileSystemId:  volume.Efs.FileSystemId,
+			RootDirectory: volume.Efs.RootDirectory,
+		}
+		if volume.Efs.TransitEncryption || len(volume.Efs.AccessPointId) != 0 {
+			res.EfsVolumeConfiguration.TransitEncryption = "ENABLED"
+		}
+		if len(volume.Efs.AccessPointId) != 0 {
+			res.EfsVolumeConfiguration.AuthorizationConfig = &ecsEfsAuthorization{
+				AccessPointId: volume.Efs.AccessPointId,
+				Iam:           "ENABLED",
+			}
+		}
+	default:
+		res.DockerVolumeConfiguration = &ecsDockerVolume{
+			Scope:         "shared",
+			Autoprovision: true,
+			Driver:        volume.Driver,
+		}
+	}
+	return res
+}
+
+func (conf *HclConf) EcsVolumes(group string) []ecsVolume {
+	names := map[string]bool{}
+	for _, service := range conf.Services {
+		if service.Ecs != group {
+			continue
+		}
+		for volume := range service.Mounts {
+			names[volume] = true
+		}
+	}
+	sorted := []string{}
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Sort(ByString(sorted))
+	res := []ecsVolume{}
+	for _, name := range sorted {
+		volume := conf.Volumes[name]
+		res = append(res, volume.asEcs())
+	}
+	return res
+}
+
+func (service *hclConfService) composeVolumes(conf *HclConf) []string {
+	res := []string{}
+	for _, mount := range service.ecsMountPoints() {
+		source := mount.SourceVolume
+		if volume := conf.Volumes[source]; len(volume.HostPath) != 0 {
+			source = volume.HostPath
+		}
+		value := fmt.Sprintf("%s:%s", source, mount.ContainerPath)
+		if mount.ReadOnly {
+			value += ":ro"
+		}
+		res = append(res, value)
+	}
+	return res
+}
+
+func (conf *HclConf) composeNamedVolumes() map[string]composeVolume {
+	var res map[string]composeVolume
+	for _, service := range conf.Services {
+		if !service.Compose {
+			continue
+		}
+		for name := range service.Mounts {
+			volume := conf.Volumes[name]
+			if len(volume.HostPath) != 0 {
+				continue
+			}
+			if res == nil {
+				res = map[string]composeVolume{}
+			}
+			res[name] = composeVolume{Driver: volume.Driver}
+		}
+	}
+	return res
+}
@@ -0,0 +1,87 @@
+package libtf
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVolumes(t *testing.T) {
+	conf, _ := loadTestConf(t, `
+volume "pgdata" {}
+
+volume "logs" {
+  host_path = "/var/log/app"
+}
+
+volume "media" {
+  efs {
+    file_system_id  = "fs-1234"
+    access_point_id = "fsap-1234"
+  }
+}
+
+service "db" {
+  image   = "postgres"
+  compose = true
+  mount "pgdata" {
+    path = "/var/lib/postgresql/data"
+  }
+}
+
+service "web" {
+  image        = "web"
+  ecs          = "web"
+  compose      = true
+  memory       = 128
+  volumes_from = ["sidecar:ro"]
+  mount "logs" {
+    path = "/app/logs"
+  }
+  mount "media" {
+    path      = "/app/media"
+    read_only = true
+  }
+}
+
+service "sidecar" {
+  image  = "sidecar"
+  ecs    = "web"
+  memory = 64
+}
+`)
+	assert.Nil(t, conf.validateVolumes())
+
+	vault := testVault("test")
+	web := conf.Services["web"]
+	ecs := web.asEcs(&conf, vault, nil)
+	assert.Equal(t, []ecsMountPoint{
+		{SourceVolume: "logs", ContainerPath: "/app/logs"},
+		{SourceVolume: "media", ContainerPath: "/app/media", ReadOnly: true},
+	}, ecs.MountPoints)
+	assert.Equal(t, []ecsVolumeFrom{{SourceContainer: "sidecar", ReadOnly: true}}, ecs.VolumesFrom)
+
+	assert.Equal(t, []ecsVolume{
+		{Name: "logs", Host: &ecsHostVolume{SourcePath: "/var/log/app"}},
+		{Name: "media", EfsVolumeConfiguration: &ecsEfsVolume{
+			FileSystemId:        "fs-1234",
+			TransitEncryption:   "ENABLED",
+			AuthorizationConfig: &ecsEfsAuthorization{AccessPointId: "fsap-1234", Iam: "ENABLED"},
+		}},
+	}, conf.EcsVolumes("web"))
+
+	compose := conf.AsCompose(vault)
+	assert.Equal(t, []string{"pgdata:/var/lib/postgresql/data"}, compose.Services["db"].Volumes)
+	assert.Equal(t, []string{"/var/log/app:/app/logs", "media:/app/media:ro"}, compose.Services["web"].Volumes)
+	assert.Equal(t, []string{"sidecar:ro"}, compose.Services["web"].VolumesFrom)
+	assert.Equal(t, map[string]composeVolume{"pgdata": {}, "media": {}}, compose.Volumes)
+
+	db := conf.Services["db"]
+	db.Mounts["missing"] = hclConfMount{Path: "/data"}
+	assert.Error(t, conf.validateVolumes())
+	delete(db.Mounts, "missing")
+
+	web.VolumesFrom = []string{"db"}
+	conf.Services["web"] = web
+	assert.Error(t, conf.validateVolumes())
+}
@@ -9,7 +9,7 @@ import (
 	"io/ioutil"
 	"os"
 	"os/exec"
-	"sort"
+	"path/filepath"
 	"strings"
 	"syscall"
 
@@ -69,87 +69,407 @@ func commandCompose(conf libtf.HclConf, vault libtf.Vault) {
 	syscall.Exec(bin, append([]string{"docker-compose", "-f", ".compose.yml"}, flag.Args()[1:]...), os.Environ())
 }
 
+func prepareTerraform(conf libtf.HclConf, vault libtf.Vault, target string) ([]string, error) {
+	dir := conf.TargetDefs[target].Path
+
+	ecsDefs, err := conf.WriteEcsDefs(vault, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	outputs, err := conf.DependencyOutputs(vault, target)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conf.EnsureRemoteState(vault, dir, target); err != nil {
+		return nil, err
+	}
+
+	env, err := conf.TerraformEnv(vault, ecsDefs)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range outputs {
+		env = append(env, fmt.Sprintf("%s=%s", key, value))
+	}
+
+	return conf.TargetEnv(target, env)
+}
+
+func pushSecrets(conf libtf.HclConf, vault libtf.Vault) error {
+	if len(conf.Global.Secrets) == 0 {
+		return nil
+	}
+	secrets, err := conf.PushSecrets(vault)
+	if err != nil {
+		return err
+	}
+	emoji.Printf(":key: pushed %d secrets to %s\n", len(secrets), conf.Global.Secrets)
+	return nil
+}
+
 func commandTerraform(conf libtf.HclConf, vault libtf.Vault, target string) {
-	if err := os.Chdir(target); err != nil {
+	if flag.Arg(1) == "apply" {
+		if err := pushSecrets(conf, vault); err != nil {
+			panic(err)
+		}
+	}
+
+	env, err := prepareTerraform(conf, vault, target)
+	if err != nil {
+		panic(err)
+	}
+
+	if err := os.Chdir(conf.TargetDefs[target].Path); err != nil {
+		panic(err)
+	}
+
+	terraformBin, err := exec.LookPath("terraform")
+	if err != nil {
 		panic(err)
 	}
 
-	services := map[string][]libtf.EcsServiceConfig{}
-	conf.AsEcs(vault, services)
+	syscall.Exec(terraformBin, append([]string{"terraform"}, flag.Args()[1:]...), env)
+}
+
+func execTerraform(conf libtf.HclConf, target string, env []string, args []string) error {
+	terraformBin, err := exec.LookPath("terraform")
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(terraformBin, args...)
+	cmd.Dir = conf.TargetDefs[target].Path
+	cmd.Env = env
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func runTerraform(conf libtf.HclConf, vault libtf.Vault, target string, args []string) error {
+	env, err := prepareTerraform(conf, vault, target)
+	if err != nil {
+		return err
+	}
+	return execTerraform(conf, target, env, args)
+}
 
-	if err := libtf.RimRaf(".ecs-def"); err != nil {
+func requireCleanGit() {
+	clean, err := libtf.GitIsClean()
+	if err != nil {
 		panic(err)
 	}
+	if !clean {
+		color.Red("git work tree has uncommitted changes, commit them before using saved plans")
+		os.Exit(1)
+	}
+}
 
-	if err := os.Mkdir(".ecs-def", 0700); err != nil {
+func commandPlanSave(conf libtf.HclConf, vault libtf.Vault, target string) {
+	dir := conf.TargetDefs[target].Path
+
+	requireCleanGit()
+
+	env, err := prepareTerraform(conf, vault, target)
+	if err != nil {
 		panic(err)
 	}
 
-	for key, value := range services {
-		data, err := json.MarshalIndent(value, "", "  ")
-		if err != nil {
-			panic(err)
-		}
+	planFile := libtf.PlanFile(vault.EnvName())
+	if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(planFile)), 0700); err != nil {
+		panic(err)
+	}
 
-		err = ioutil.WriteFile(fmt.Sprintf(".ecs-def/%s.json", key), data, 0600)
-		if err != nil {
-			panic(err)
+	args := append([]string{"plan", fmt.Sprintf("-out=%s", planFile)}, flag.Args()[2:]...)
+	if err := execTerraform(conf, target, env, args); err != nil {
+		color.Red("%s", err)
+		os.Exit(1)
+	}
+
+	manifest, err := conf.NewPlanManifest(vault)
+	if err != nil {
+		panic(err)
+	}
+	if err := manifest.Save(filepath.Join(dir, libtf.PlanManifestFile(vault.EnvName()))); err != nil {
+		panic(err)
+	}
+	emoji.Printf(":ok_hand: %s\n", filepath.Join(dir, planFile))
+}
+
+func commandApplySaved(conf libtf.HclConf, vault libtf.Vault, target string) {
+	dir := conf.TargetDefs[target].Path
+
+	requireCleanGit()
+
+	planned, err := libtf.LoadPlanManifest(filepath.Join(dir, libtf.PlanManifestFile(vault.EnvName())))
+	if err != nil {
+		panic(err)
+	}
+
+	current, err := conf.NewPlanManifest(vault)
+	if err != nil {
+		panic(err)
+	}
+
+	if changes := planned.Diff(current); len(changes) != 0 {
+		for _, change := range changes {
+			color.Red("%s", change)
 		}
+		color.Red("refusing to apply %s, run plan-save again", libtf.PlanFile(vault.EnvName()))
+		os.Exit(1)
 	}
 
-	vault.InitRemoteState(target)
+	env, err := prepareTerraform(conf, vault, target)
+	if err != nil {
+		panic(err)
+	}
+
+	if err := os.Chdir(dir); err != nil {
+		panic(err)
+	}
 
 	terraformBin, err := exec.LookPath("terraform")
 	if err != nil {
 		panic(err)
 	}
 
-	env := []string{}
-	for key, value := range vault.Raw {
-		env = append(env, fmt.Sprintf("%s=%s", key, value))
+	args := append([]string{"terraform", "apply"}, flag.Args()[2:]...)
+	syscall.Exec(terraformBin, append(args, libtf.PlanFile(vault.EnvName())), env)
+}
+
+func commandPolicy(conf libtf.HclConf, vault libtf.Vault, target string) {
+	dir := conf.TargetDefs[target].Path
+
+	if err := conf.EnsureRemoteState(vault, dir, target); err != nil {
+		panic(err)
 	}
-	for service := range services {
-		env = append(env, fmt.Sprintf("%s=.ecs-def/%s.json", libtf.EnvKey(libtf.EcsTemplateVar(service)), service))
+
+	env, err := conf.TerraformEnv(vault, nil)
+	if err != nil {
+		panic(err)
 	}
-	for _, target := range conf.Targets {
-		env = append(env, fmt.Sprintf("%s=%s", libtf.EnvKey(libtf.StateKeyVar(target)), libtf.StateKey(vault.EnvName(), target)))
+
+	terraformBin, err := exec.LookPath("terraform")
+	if err != nil {
+		panic(err)
 	}
-	//env = append(env, "TF_INPUT=0")
-	//env[idx] = "TF_INPUT=0"
 
-	env = append(env, []string{
-		fmt.Sprintf("AWS_ACCESS_KEY_ID=%s", vault.AwsKey()),
-		fmt.Sprintf("AWS_SECRET_ACCESS_KEY=%s", vault.AwsSecret()),
-		fmt.Sprintf("AWS_DEFAULT_REGION=%s", vault.AwsRegion()),
-	}...)
+	cmd := exec.Command(terraformBin, "show", "-json", libtf.PlanFile(vault.EnvName()))
+	cmd.Dir = dir
+	cmd.Env = libtf.WithProcessEnv(env)
+	cmd.Stderr = os.Stderr
+	planJSON, err := cmd.Output()
+	if err != nil {
+		color.Red("%s, run plan-save first", err)
+		os.Exit(1)
+	}
 
-	syscall.Exec(terraformBin, append([]string{"terraform"}, flag.Args()[1:]...), append(env, os.Environ()...))
+	violations, err := conf.CheckPolicies(planJSON, vault.EnvName())
+	if err != nil {
+		panic(err)
+	}
+
+	if len(violations) != 0 {
+		for _, violation := range violations {
+			color.Red("%s", violation)
+		}
+		os.Exit(1)
+	}
+	emoji.Printf(":ok_hand: %s passes %d policies\n", libtf.PlanFile(vault.EnvName()), len(conf.Policies))
 }
 
-func commandVariables(conf libtf.HclConf, vault libtf.Vault) {
-	keys := []string{}
+func runAll(conf libtf.HclConf, vault libtf.Vault, order []string, args []string) bool {
+	if args[0] == "apply" {
+		if err := pushSecrets(conf, vault); err != nil {
+			color.Red("%s", err)
+			return false
+		}
+	}
 
-	services := map[string][]libtf.EcsServiceConfig{}
-	conf.AsEcs(vault, services)
+	results := map[string]error{}
+	var failed error
+	for _, target := range order {
+		emoji.Printf(":point_right: %s %s\n", target, strings.Join(args, " "))
+		failed = runTerraform(conf, vault, target, args)
+		results[target] = failed
+		if failed != nil {
+			break
+		}
+	}
 
-	for service := range services {
-		keys = append(keys, libtf.EcsTemplateVar(service))
+	fmt.Println()
+	for _, target := range order {
+		err, done := results[target]
+		switch {
+		case !done:
+			color.Yellow("skipped %s", target)
+		case err != nil:
+			color.Red("failed  %s: %s", target, err)
+		default:
+			color.Green("ok      %s", target)
+		}
 	}
 
-	for _, target := range conf.Targets {
-		keys = append(keys, libtf.StateKeyVar(target))
+	return failed == nil
+}
+
+func commandAll(conf libtf.HclConf, vault libtf.Vault) {
+	args := flag.Args()[1:]
+	if len(args) == 0 {
+		fmt.Println("usage: tf all plan|apply|<terraform command>")
+		os.Exit(1)
+	}
+
+	order, err := conf.TargetOrder()
+	if err != nil {
+		panic(err)
+	}
+
+	if !runAll(conf, vault, order, args) {
+		os.Exit(1)
+	}
+}
+
+func commandEnv(conf libtf.HclConf) {
+	action := flag.Arg(1)
+	envName := flag.Arg(2)
+	if (action != "create" && action != "destroy") || len(envName) == 0 {
+		fmt.Println("usage: tf env create <name> --from=name.vault|name.yml [terraform args]")
+		fmt.Println("       tf env destroy <name> [terraform args]")
+		os.Exit(1)
+	}
+
+	flags := flag.NewFlagSet("env", flag.ExitOnError)
+	from := flags.String("from", "", "")
+	flags.Parse(flag.Args()[3:])
+
+	if conf.IsProtected(envName) {
+		color.Red("%s is protected", envName)
+		os.Exit(1)
+	}
+
+	order, err := conf.TargetOrder()
+	if err != nil {
+		panic(err)
 	}
 
-	for key, variable := range conf.Env {
-		if !variable.Optional {
-			keys = append(keys, key)
+	vaultFile := fmt.Sprintf("%s.vault", envName)
+
+	if action == "create" {
+		if len(*from) == 0 {
+			color.Red("--from is required")
+			os.Exit(1)
+		}
+		if _, err := os.Stat(vaultFile); err == nil {
+			color.Red("%s already exists", vaultFile)
+			os.Exit(1)
+		}
+
+		source := loadVault(conf, *from)
+		vault, err := conf.VaultForEnv(source, envName)
+		if err != nil {
+			panic(err)
+		}
+
+		keyString := conf.Keys[conf.Global.ProjectName]
+		if len(keyString) == 0 {
+			panic("no key found in ~/.tfrc")
+		}
+		data, err := vault.Encode(keyString)
+		if err != nil {
+			panic(err)
+		}
+		if err := ioutil.WriteFile(vaultFile, data, 0600); err != nil {
+			panic(err)
+		}
+		emoji.Printf(":ok_hand: %s\n", vaultFile)
+
+		vault.AddDefaults()
+		if !runAll(conf, *vault, order, append([]string{"apply"}, flags.Args()...)) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	vault := loadVault(conf, vaultFile)
+
+	reversed := make([]string, len(order))
+	for idx, target := range order {
+		reversed[len(order)-1-idx] = target
+	}
+	if !runAll(conf, vault, reversed, append([]string{"destroy"}, flags.Args()...)) {
+		os.Exit(1)
+	}
+
+	for _, target := range reversed {
+		if err := conf.DeleteState(vault, target); err != nil {
+			color.Red("%s: %s", target, err)
+			os.Exit(1)
+		}
+	}
+	emoji.Printf(":ok_hand: %s destroyed, remove %s when no longer needed\n", envName, vaultFile)
+}
+
+func commandVariables(conf libtf.HclConf, vault libtf.Vault) {
+	flags := flag.NewFlagSet("variables", flag.ExitOnError)
+	write := flags.String("write", "", "")
+	check := flags.Bool("check", false, "")
+	flags.Parse(flag.Args()[1:])
+
+	if *check {
+		problems, err := conf.CheckVariables(vault)
+		if err != nil {
+			panic(err)
+		}
+		for _, problem := range problems {
+			color.Red("%s", problem)
+		}
+		if len(problems) != 0 {
+			os.Exit(1)
 		}
+		emoji.Println(":ok_hand: variables match")
+		return
 	}
 
-	sort.Sort(libtf.ByString(keys))
+	if len(*write) == 0 {
+		os.Stdout.Write(libtf.RenderTerraformVariables(conf.TerraformVariables()))
+		return
+	}
 
-	for _, key := range keys {
-		fmt.Printf("variable \"%s\" {}\n", key)
+	header := []byte("# generated by tf variables, do not edit\n\n")
+	for _, target := range conf.Targets {
+		filename := filepath.Join(conf.TargetDefs[target].Path, *write)
+		variables, err := conf.TargetTerraformVariables(target, *write)
+		if err != nil {
+			panic(err)
+		}
+		if len(variables) == 0 {
+			if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+				panic(err)
+			}
+			continue
+		}
+		data := libtf.RenderTerraformVariables(variables)
+		if err := ioutil.WriteFile(filename, append(header, data...), 0644); err != nil {
+			panic(err)
+		}
+		emoji.Printf(":ok_hand: %s\n", filename)
+	}
+}
+
+func commandSecrets(conf libtf.HclConf, vault libtf.Vault) {
+	if flag.Arg(1) != "push" {
+		fmt.Println("usage: tf secrets push")
+		os.Exit(1)
+	}
+	if len(conf.Global.Secrets) == 0 {
+		color.Red("global.secrets is not set")
+		os.Exit(1)
+	}
+	if err := pushSecrets(conf, vault); err != nil {
+		panic(err)
 	}
 }
 
@@ -188,11 +508,60 @@ func commandRunEcsTask(conf libtf.HclConf, vault libtf.Vault, allInstances bool)
 	}
 }
 
+func requiresConfirmation(conf libtf.HclConf) bool {
+	switch flag.Arg(0) {
+	case "ecs-task":
+		return true
+	case "encrypt":
+		_, err := os.Stat(flag.Arg(1))
+		return err == nil
+	case "secrets":
+		return true
+	}
+	isTarget := flag.Arg(0) == "all"
+	for _, target := range conf.Targets {
+		if target == flag.Arg(0) {
+			isTarget = true
+		}
+	}
+	switch flag.Arg(1) {
+	case "apply", "destroy", "apply-saved":
+		return isTarget
+	}
+	return false
+}
+
+func loadVault(conf libtf.HclConf, vaultFile string) libtf.Vault {
+	vault := libtf.Vault{}
+	var err error
+	if vaultFile == "env" {
+		err = conf.LoadEnv(&vault)
+	} else if strings.HasSuffix(vaultFile, ".yml") {
+		err = conf.LoadYamlFile(vaultFile, &vault)
+	} else if strings.HasSuffix(vaultFile, ".vault") {
+		err = conf.LoadVault(vaultFile, &vault)
+	} else {
+		panic("invalid vault filename")
+	}
+
+	if err != nil {
+		if os.IsNotExist(err) {
+			panic(err)
+		}
+		color.Red("%s", err)
+		os.Exit(1)
+	}
+
+	vault.AddDefaults()
+	return vault
+}
+
 func main() {
 
 	configFile := flag.String("config", ".tf.hcl", "")
 	vaultFile := flag.String("vault", "env", "")
 	allInstances := flag.Bool("all_instances", false, "")
+	yes := flag.Bool("yes", false, "")
 
 	flag.Parse()
 
@@ -208,33 +577,27 @@ func main() {
 
 	libtf.GetGitVersion()
 
-	vault := libtf.Vault{}
-	var err error
-	if *vaultFile == "env" {
-		err = conf.LoadEnv(&vault)
-	} else if strings.HasSuffix(*vaultFile, ".yml") {
-		err = conf.LoadYamlFile(*vaultFile, &vault)
-	} else if strings.HasSuffix(*vaultFile, ".vault") {
-		err = conf.LoadVault(*vaultFile, &vault)
-	} else {
-		panic("invalid vault filename")
+	if flag.Arg(0) == "env" {
+		commandEnv(conf)
+		return
 	}
 
-	if err != nil {
-		if os.IsNotExist(err) {
-			panic(err)
+	vault := loadVault(conf, *vaultFile)
+
+	if conf.IsProtected(vault.EnvName()) && requiresConfirmation(conf) {
+		if err := libtf.ConfirmEnv(vault.EnvName(), *yes, os.Stdin, os.Stdout); err != nil {
+			color.Red("%s", err)
+			os.Exit(1)
 		}
-		color.Red("%s", err)
-		os.Exit(1)
 	}
 
-	vault.AddDefaults()
-
 	switch flag.Arg(0) {
 	case "run":
 		commandRun(conf, vault)
 	case "run-env":
 		commandRunEnv(conf, vault)
+	case "all":
+		commandAll(conf, vault)
 	case "ecs-task":
 		commandRunEcsTask(conf, vault, *allInstances)
 	case "dump":
@@ -243,6 +606,8 @@ func main() {
 		commandCompose(conf, vault)
 	case "variables":
 		commandVariables(conf, vault)
+	case "secrets":
+		commandSecrets(conf, vault)
 	case "encrypt":
 		commandEncrypt(conf, vault)
 	case "decrypt":
@@ -253,13 +618,22 @@ func main() {
 		for _, target := range conf.Targets {
 			if target == flag.Arg(0) {
 				found = true
-				commandTerraform(conf, vault, target)
+				switch flag.Arg(1) {
+				case "plan-save":
+					commandPlanSave(conf, vault, target)
+				case "apply-saved":
+					commandApplySaved(conf, vault, target)
+				case "policy":
+					commandPolicy(conf, vault, target)
+				default:
+					commandTerraform(conf, vault, target)
+				}
 				break
 			}
 		}
 		if !found {
-			commands := strings.Join(append([]string{"run", "run-env", "dump", "ecs-task", "compose", "variables", "encrypt", "decrypt"}, conf.Targets...), "|")
-			fmt.Printf("usage: tf -config=.tf.hcl -vault=env|name.yml|name.vault %s\n", commands)
+			commands := strings.Join(append([]string{"run", "run-env", "dump", "all", "env", "ecs-task", "compose", "variables", "secrets", "encrypt", "decrypt"}, conf.Targets...), "|")
+			fmt.Printf("usage: tf -config=.tf.hcl|dir [-yes] -vault=env|name.yml|name.vault %s\n", commands)
 			os.Exit(1)
 		}
 	}